@@ -0,0 +1,287 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format of the time a backup was taken, added to the end of backup filenames
+const backupTimeFormat = "20060102-150405.000000000"
+
+// backupDir returns the directory backups are kept in,
+// $XDG_STATE_HOME/schemer2/backups
+func backupDir() (string, error) {
+	state := os.Getenv("XDG_STATE_HOME")
+	if state == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		state = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(state, "schemer2", "backups"), nil
+}
+
+// backupName returns the name of a backup of the file at path, taken at t.
+// The full path of the file is kept in the name so that it can be restored.
+func backupName(path string, t time.Time) string {
+	return url.PathEscape(path) + "." + t.Format(backupTimeFormat)
+}
+
+// Most symlinks followed to find the file a path names, as the kernel allows
+const maxSymlinks = 40
+
+// resolvePath returns the absolute path of the file that path names,
+// following symlinks, even when the file they point to doesn't exist yet.
+// Config files are often symlinks into a dotfiles repository, and it is the
+// file there that must be backed up and replaced, not the symlink.
+func resolvePath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	for i := 0; i < maxSymlinks; i++ {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return resolved, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		// The file doesn't exist, but path may be a symlink to where it will be
+		target, err := os.Readlink(path)
+		if err != nil {
+			return path, nil
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		path = target
+	}
+	return "", errors.New("Too many symlinks at " + path)
+}
+
+// backupFile saves a timestamped copy of the file at path, if it exists
+func backupFile(path string) error {
+	path, err := resolvePath(path)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	dir, err := backupDir()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, backupName(path, time.Now())), data, 0600)
+	if err != nil {
+		return err
+	}
+	return pruneBackups(path, *backupCount)
+}
+
+// pruneBackups deletes all but the newest keep backups of the file at path.
+// A keep of 0 keeps them all.
+func pruneBackups(path string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	backups, err := listBackups()
+	if err != nil {
+		return err
+	}
+	kept := 0
+	for _, b := range backups {
+		if b.path != path {
+			continue
+		}
+		kept++
+		if kept <= keep {
+			continue
+		}
+		err = os.Remove(b.filename)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic replaces the file at path with data, by writing to a
+// temporary file and renaming it, so the file is never left half written.
+// If path is a symlink, the file it points to is replaced.
+func writeFileAtomic(path string, data []byte) error {
+	path, err := resolvePath(path)
+	if err != nil {
+		return err
+	}
+	mode := os.FileMode(0644)
+	info, statErr := os.Stat(path)
+	if statErr == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	// Clean up if anything fails before the rename
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(tmp.Name(), mode)
+	if err != nil {
+		return err
+	}
+	if statErr == nil {
+		keepOwner(tmp.Name(), info)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+type Backup struct {
+	path     string // File that was backed up
+	taken    time.Time
+	filename string // Backup of the file
+}
+
+// listBackups returns every backup, newest first
+func listBackups() ([]Backup, error) {
+	dir, err := backupDir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backups := make([]Backup, 0)
+	for _, f := range files {
+		dot := strings.LastIndex(f.Name(), ".")
+		// The timestamp itself contains a dot
+		if dot > 0 {
+			dot = strings.LastIndex(f.Name()[:dot], ".")
+		}
+		if dot < 0 {
+			continue
+		}
+		path, err := url.PathUnescape(f.Name()[:dot])
+		if err != nil {
+			continue
+		}
+		taken, err := time.ParseInLocation(backupTimeFormat, f.Name()[dot+1:], time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, Backup{path, taken, filepath.Join(dir, f.Name())})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].taken.After(backups[j].taken)
+	})
+	return backups, nil
+}
+
+// restoreCommand lists backups, or restores one.
+//
+//	schemer2 restore             Lists every backed up file
+//	schemer2 restore FILE        Lists the backups of FILE, newest first
+//	schemer2 restore FILE N      Restores backup N of FILE
+func restoreCommand(args []string) error {
+	backups, err := listBackups()
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		if len(backups) == 0 {
+			fmt.Println("No backups found.")
+			return nil
+		}
+		counts := make(map[string]int)
+		paths := make([]string, 0)
+		for _, b := range backups {
+			if counts[b.path] == 0 {
+				paths = append(paths, b.path)
+			}
+			counts[b.path]++
+		}
+		sort.Strings(paths)
+		for _, p := range paths {
+			fmt.Printf("%v (%d backups)\n", p, counts[p])
+		}
+		return nil
+	}
+
+	path, err := resolvePath(args[0])
+	if err != nil {
+		return err
+	}
+	fileBackups := make([]Backup, 0)
+	for _, b := range backups {
+		if b.path == path {
+			fileBackups = append(fileBackups, b)
+		}
+	}
+	if len(fileBackups) == 0 {
+		return errors.New("No backups found for " + path)
+	}
+
+	if len(args) == 1 {
+		for i, b := range fileBackups {
+			fmt.Printf("%3d  %v\n", i+1, b.taken.Format("2006-01-02 15:04:05"))
+		}
+		fmt.Println("Run 'schemer2 restore " + args[0] + " N' to restore backup N.")
+		return nil
+	}
+
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n < 1 || n > len(fileBackups) {
+		return errors.New("Backup number must be between 1 and " + strconv.Itoa(len(fileBackups)))
+	}
+	data, err := ioutil.ReadFile(fileBackups[n-1].filename)
+	if err != nil {
+		return err
+	}
+	// Back up the current file too, so that restoring can be undone
+	err = backupFile(path)
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(path, data)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Restored " + path + " from " + fileBackups[n-1].taken.Format("2006-01-02 15:04:05"))
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// keepOwner does nothing where files don't have a Unix owner
+func keepOwner(path string, replaced os.FileInfo) {}
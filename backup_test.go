@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomicFollowsSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	err := os.Mkdir(filepath.Join(dir, "dotfiles"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(dir, "dotfiles", "kitty.conf")
+	err = ioutil.WriteFile(target, []byte("color1 #000000\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "kitty.conf")
+	err = os.Symlink(filepath.Join("dotfiles", "kitty.conf"), link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A symlink to a file that doesn't exist yet
+	dangling := filepath.Join(dir, "new.conf")
+	err = os.Symlink(filepath.Join("dotfiles", "new.conf"), dangling)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{link, dangling} {
+		err = writeFileAtomic(path, []byte("color1 #ffffff\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Lstat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			t.Errorf("%v was replaced by a regular file", path)
+		}
+	}
+
+	for _, path := range []string{target, filepath.Join(dir, "dotfiles", "new.conf")} {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "color1 #ffffff\n" {
+			t.Errorf("%v contains %q, expected it to be written through the symlink", path, data)
+		}
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Mode of %v changed to %v", target, info.Mode().Perm())
+	}
+}
+
+func TestBackupsArePruned(t *testing.T) {
+	registerDefaults()
+	dir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", filepath.Join(dir, "state"))
+	saved := *backupCount
+	*backupCount = 3
+	t.Cleanup(func() { *backupCount = saved })
+
+	path := filepath.Join(dir, "kitty.conf")
+	other := filepath.Join(dir, "Xresources")
+	for i := 0; i < 5; i++ {
+		for _, p := range []string{path, other} {
+			err := ioutil.WriteFile(p, []byte{byte('0' + i)}, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = backupFile(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	backups, err := listBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := make(map[string]string)
+	for _, b := range backups {
+		data, err := ioutil.ReadFile(b.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kept[filepath.Base(b.path)] += string(data)
+	}
+	// The newest backups of each file are kept, newest first
+	if kept["kitty.conf"] != "432" || kept["Xresources"] != "432" {
+		t.Errorf("Kept backups %v, expected 432 of each file", kept)
+	}
+
+	// With a count of 0 every backup is kept
+	*backupCount = 0
+	for i := 0; i < 2; i++ {
+		err = backupFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	backups, _ = listBackups()
+	if len(backups) != 8 {
+		t.Errorf("Expected 8 backups, found %d", len(backups))
+	}
+}
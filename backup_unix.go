@@ -0,0 +1,17 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// keepOwner gives the file at path the owner and group of the file it
+// replaces. This can only fail when running as another user, and then the
+// file is left owned by that user, as it would be without replacing it.
+func keepOwner(path string, replaced os.FileInfo) {
+	if stat, ok := replaced.Sys().(*syscall.Stat_t); ok {
+		os.Chown(path, int(stat.Uid), int(stat.Gid))
+	}
+}
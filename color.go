@@ -0,0 +1,279 @@
+package main
+
+import (
+	"errors"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// CSS color names that aren't in the X11 database. Where CSS and X11 give a
+// name different colors, such as "green", the X11 color is used, as the
+// terminals that accept names look them up as X11 does.
+var cssColors = map[string]color.NRGBA{
+	"aqua":          {0, 255, 255, 255},
+	"crimson":       {220, 20, 60, 255},
+	"fuchsia":       {255, 0, 255, 255},
+	"indigo":        {75, 0, 130, 255},
+	"lime":          {0, 255, 0, 255},
+	"olive":         {128, 128, 0, 255},
+	"rebeccapurple": {102, 51, 153, 255},
+	"silver":        {192, 192, 192, 255},
+	"teal":          {0, 128, 128, 255},
+	"transparent":   {0, 0, 0, 0},
+}
+
+// nrgba64 returns a color with 16-bit channels that aren't premultiplied by
+// alpha, which is how colors are kept from reading a scheme to writing it.
+// A nil color is transparent black.
+func nrgba64(c color.Color) color.NRGBA64 {
+	switch cc := c.(type) {
+	case nil:
+		return color.NRGBA64{}
+	case color.NRGBA64:
+		return cc
+	case color.NRGBA:
+		return color.NRGBA64{uint16(cc.R) * 257, uint16(cc.G) * 257, uint16(cc.B) * 257, uint16(cc.A) * 257}
+	}
+	return color.NRGBA64Model.Convert(c).(color.NRGBA64)
+}
+
+// normalizeColors converts colors of any color model to the one used
+// inside a scheme, so that readers and callers may return any of them.
+func normalizeColors(colors []color.Color) []color.Color {
+	normalized := make([]color.Color, len(colors))
+	for i, c := range colors {
+		normalized[i] = nrgba64(c)
+	}
+	return normalized
+}
+
+// quantize rounds a 16-bit channel to 8 bits
+func quantize(v uint16) uint8 {
+	return uint8((uint32(v)*255 + 0xffff/2) / 0xffff)
+}
+
+// nrgba returns a color with 8-bit channels that aren't premultiplied by
+// alpha, for writing formats with no more precision than that.
+func nrgba(c color.Color) color.NRGBA {
+	cc := nrgba64(c)
+	return color.NRGBA{quantize(cc.R), quantize(cc.G), quantize(cc.B), quantize(cc.A)}
+}
+
+// opacity returns the alpha of a color, from 0 for transparent to 1
+func opacity(c color.Color) float64 {
+	return float64(nrgba64(c).A) / 0xffff
+}
+
+// withOpacity returns a color with its alpha replaced, from 0 to 1
+func withOpacity(c color.Color, alpha float64) color.Color {
+	if math.IsNaN(alpha) {
+		alpha = 1
+	}
+	cc := nrgba64(c)
+	cc.A = to16(math.Max(0, math.Min(1, alpha)))
+	return cc
+}
+
+// to16 scales a channel from 0 to 1 to 16 bits
+func to16(f float64) uint16 {
+	return uint16(f*0xffff + 0.5)
+}
+
+// scaleHex scales a hex number of 1 to 4 digits to 16 bits, Eg. "f" and
+// "ffff" are both 65535.
+func scaleHex(digits string) (uint16, error) {
+	if len(digits) < 1 || len(digits) > 4 {
+		return 0, errors.New("Expected 1 to 4 hex digits, found '" + digits + "'")
+	}
+	v, err := strconv.ParseUint(digits, 16, 16)
+	if err != nil {
+		return 0, err
+	}
+	max := uint64(1)<<(4*uint(len(digits))) - 1
+	return uint16((v*0xffff + max/2) / max), nil
+}
+
+// parseHexColor parses the digits of a "#" color: 3 or 4 digits as in CSS,
+// where "#f00" is "#ff0000", or 6 or 8 digits, with alpha last when there
+// are 4 or 8. 9 and 12 digits give 3 or 4 digits to each channel, as in X11.
+func parseHexColor(digits string) (color.NRGBA64, error) {
+	perChannel, channels := 0, 3
+	switch len(digits) {
+	case 3, 6:
+		perChannel = len(digits) / 3
+	case 4, 8:
+		perChannel, channels = len(digits)/4, 4
+	case 9, 12:
+		perChannel = len(digits) / 3
+	default:
+		return color.NRGBA64{}, errors.New("Expected 3, 4, 6, 8, 9 or 12 hex digits")
+	}
+	v := []uint16{0, 0, 0, 0xffff}
+	for i := 0; i < channels; i++ {
+		channel, err := scaleHex(digits[i*perChannel : (i+1)*perChannel])
+		if err != nil {
+			return color.NRGBA64{}, err
+		}
+		v[i] = channel
+	}
+	return color.NRGBA64{v[0], v[1], v[2], v[3]}, nil
+}
+
+// parseX11Spec parses the channels of an X11 "rgb:r/g/b" color, with 1 to 4
+// hex digits per channel, or "rgbi:r/g/b" with intensities from 0 to 1.
+func parseX11Spec(channels string, intensity bool) (color.NRGBA64, error) {
+	parts := strings.Split(channels, "/")
+	if len(parts) != 3 {
+		return color.NRGBA64{}, errors.New("Expected 3 channels separated by '/'")
+	}
+	v := make([]uint16, 3)
+	for i, part := range parts {
+		if !intensity {
+			channel, err := scaleHex(part)
+			if err != nil {
+				return color.NRGBA64{}, err
+			}
+			v[i] = channel
+			continue
+		}
+		f, err := strconv.ParseFloat(part, 64)
+		if err != nil || !(f >= 0 && f <= 1) {
+			return color.NRGBA64{}, errors.New("Expected an intensity from 0 to 1, found '" + part + "'")
+		}
+		v[i] = to16(f)
+	}
+	return color.NRGBA64{v[0], v[1], v[2], 0xffff}, nil
+}
+
+// cssNumber parses a number of a CSS color function, scaling a percentage to
+// max, and clamping the result to between 0 and max.
+func cssNumber(s string, max float64) (float64, error) {
+	percent := strings.HasSuffix(s, "%")
+	s = strings.TrimSuffix(s, "%")
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, errors.New("Expected a number, found '" + s + "'")
+	}
+	if percent {
+		// Multiplying first keeps Eg. 50% of 255 exact
+		f = f * max / 100
+	}
+	return math.Max(0, math.Min(max, f)), nil
+}
+
+// hslToRGB converts a hue in degrees, and saturation and lightness from 0 to
+// 1, to red, green and blue from 0 to 1.
+func hslToRGB(h, s, l float64) (float64, float64, float64) {
+	h = math.Mod(h, 360)
+	if h < 0 {
+		h += 360
+	}
+	c := (1 - math.Abs(2*l-1)) * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := l - c/2
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	return r + m, g + m, b + m
+}
+
+// parseCSSFunction parses the arguments of a CSS rgb(), rgba(), hsl() or
+// hsla() color, separated by commas or spaces, with an optional alpha after
+// a comma or '/'.
+func parseCSSFunction(name string, arguments string) (color.NRGBA64, error) {
+	args := strings.Fields(strings.NewReplacer(",", " ", "/", " ").Replace(arguments))
+	if len(args) != 3 && len(args) != 4 {
+		return color.NRGBA64{}, errors.New("Expected 3 or 4 values")
+	}
+	alpha := 1.0
+	if len(args) == 4 {
+		var err error
+		alpha, err = cssNumber(args[3], 1)
+		if err != nil {
+			return color.NRGBA64{}, err
+		}
+	}
+
+	var r, g, b float64
+	if strings.HasPrefix(name, "rgb") {
+		channels := make([]float64, 3)
+		for i := range channels {
+			v, err := cssNumber(args[i], 255)
+			if err != nil {
+				return color.NRGBA64{}, err
+			}
+			channels[i] = v / 255
+		}
+		r, g, b = channels[0], channels[1], channels[2]
+	} else {
+		hue, err := strconv.ParseFloat(strings.TrimSuffix(args[0], "deg"), 64)
+		if err != nil || math.IsNaN(hue) || math.IsInf(hue, 0) {
+			return color.NRGBA64{}, errors.New("Expected a hue in degrees, found '" + args[0] + "'")
+		}
+		// Saturation and lightness are percentages, with or without the '%'
+		saturation, err := cssNumber(strings.TrimSuffix(args[1], "%")+"%", 1)
+		if err != nil {
+			return color.NRGBA64{}, err
+		}
+		lightness, err := cssNumber(strings.TrimSuffix(args[2], "%")+"%", 1)
+		if err != nil {
+			return color.NRGBA64{}, err
+		}
+		r, g, b = hslToRGB(hue, saturation, lightness)
+	}
+	return color.NRGBA64{to16(r), to16(g), to16(b), to16(alpha)}, nil
+}
+
+// parseColor parses a color literal in any of the forms terminal configs use:
+// "#" followed by 3, 4, 6, 8, 9 or 12 hex digits, X11 "rgb:" and "rgbi:"
+// colors, CSS rgb(), rgba(), hsl() and hsla(), and X11 or CSS color names,
+// ignoring case and spaces. Colors keep 16 bits per channel, and alpha when
+// it is given.
+func parseColor(c string) (color.Color, error) {
+	c = strings.TrimSpace(c)
+	lower := strings.ToLower(c)
+	var parsed color.NRGBA64
+	var err error
+	switch {
+	case strings.HasPrefix(lower, "#"):
+		parsed, err = parseHexColor(c[1:])
+	case strings.HasPrefix(lower, "rgb:"):
+		parsed, err = parseX11Spec(c[4:], false)
+	case strings.HasPrefix(lower, "rgbi:"):
+		parsed, err = parseX11Spec(c[5:], true)
+	case strings.Contains(lower, "("):
+		open := strings.Index(lower, "(")
+		name := strings.TrimSpace(lower[:open])
+		if (name != "rgb" && name != "rgba" && name != "hsl" && name != "hsla") || !strings.HasSuffix(lower, ")") {
+			return nil, errors.New("Could not parse color: " + c)
+		}
+		parsed, err = parseCSSFunction(name, lower[open+1:len(lower)-1])
+	default:
+		name := strings.Replace(lower, " ", "", -1)
+		if named, ok := x11Colors[name]; ok {
+			return nrgba64(named), nil
+		}
+		if named, ok := cssColors[name]; ok {
+			return nrgba64(named), nil
+		}
+		return nil, errors.New("Could not parse color: " + c)
+	}
+	if err != nil {
+		return nil, errors.New("Could not parse color: " + c + ": " + err.Error())
+	}
+	return parsed, nil
+}
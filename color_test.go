@@ -0,0 +1,113 @@
+package main
+
+import (
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+// Color models that any color may be given in. exact is whether the model
+// can hold every 8-bit color, so writing a scheme in it must give the same
+// output as writing the scheme itself.
+var colorModels = []struct {
+	name  string
+	model color.Model
+	exact bool
+}{
+	{"RGBA", color.RGBAModel, true},
+	{"RGBA64", color.RGBA64Model, true},
+	{"NRGBA", color.NRGBAModel, true},
+	{"NRGBA64", color.NRGBA64Model, true},
+	{"Gray", color.GrayModel, false},
+	{"Gray16", color.Gray16Model, false},
+	{"CMYK", color.CMYKModel, false},
+	{"YCbCr", color.YCbCrModel, false},
+}
+
+// TestColorModels writes a random scheme given in every color model with
+// every writer, and finds distinct colors among them as image input does,
+// checking that nothing depends on colors being of one type.
+func TestColorModels(t *testing.T) {
+	colors := randomScheme(rand.New(rand.NewSource(1)))
+	// 8-bit colors, which every exact model can hold
+	for i, c := range colors {
+		colors[i] = nrgba(c)
+	}
+
+	for _, m := range colorModels {
+		m := m
+		t.Run(m.name, func(t *testing.T) {
+			converted := make([]color.Color, len(colors))
+			for i, c := range colors {
+				converted[i] = m.model.Convert(c)
+			}
+			if m.exact {
+				for i, c := range normalizeColors(converted) {
+					if c != nrgba64(colors[i]) {
+						t.Errorf("color%d normalized to %v, expected %v", i, c, nrgba64(colors[i]))
+					}
+				}
+			}
+
+			for _, f := range formats {
+				if f.output == nil {
+					continue
+				}
+				output := f.output(converted)
+				if !m.exact {
+					continue
+				}
+				if expected := f.output(colors); output != expected {
+					t.Errorf("%v: writing %v colors changed the output\n%v", f.flagName, m.name, unifiedDiff(f.flagName, expected, output))
+				}
+			}
+			getDistinctColors(converted, 30, 0, 255)
+		})
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	for _, test := range []struct {
+		color    string
+		expected color.NRGBA64
+	}{
+		{"#abc", color.NRGBA64{0xaaaa, 0xbbbb, 0xcccc, 0xffff}},
+		{"#abcd", color.NRGBA64{0xaaaa, 0xbbbb, 0xcccc, 0xdddd}},
+		{"#CC6666", color.NRGBA64{0xcccc, 0x6666, 0x6666, 0xffff}},
+		{"#cc666680", color.NRGBA64{0xcccc, 0x6666, 0x6666, 0x8080}},
+		{"#123456789", color.NRGBA64{0x1231, 0x4564, 0x7897, 0xffff}},
+		{"#123456789abc", color.NRGBA64{0x1234, 0x5678, 0x9abc, 0xffff}},
+		{"rgb:1/22/333", color.NRGBA64{0x1111, 0x2222, 0x3333, 0xffff}},
+		{"RGB:1234/5678/9abc", color.NRGBA64{0x1234, 0x5678, 0x9abc, 0xffff}},
+		{"rgbi:0.5/1/0", color.NRGBA64{0x8000, 0xffff, 0, 0xffff}},
+		{"rgb(255, 0, 0)", color.NRGBA64{0xffff, 0, 0, 0xffff}},
+		{"rgb(300, -5, 0)", color.NRGBA64{0xffff, 0, 0, 0xffff}},
+		{"rgba(100%, 50%, 0%, 0.5)", color.NRGBA64{0xffff, 0x8000, 0, 0x8000}},
+		{"rgba(255 0 0 / 50%)", color.NRGBA64{0xffff, 0, 0, 0x8000}},
+		{"hsl(120deg 50% 50%)", color.NRGBA64{0x4000, 0xbfff, 0x4000, 0xffff}},
+		{"hsla(-90, 100%, 25%, 0.5)", color.NRGBA64{0x4000, 0, 0x8000, 0x8000}},
+		{"HSL(0, 100%, 50%)", color.NRGBA64{0xffff, 0, 0, 0xffff}},
+		{"Dark Slate Gray", color.NRGBA64{0x2f2f, 0x4f4f, 0x4f4f, 0xffff}},
+		{"RebeccaPurple", color.NRGBA64{0x6666, 0x3333, 0x9999, 0xffff}},
+		{" transparent ", color.NRGBA64{0, 0, 0, 0}},
+		{"grey", color.NRGBA64{0xbebe, 0xbebe, 0xbebe, 0xffff}},
+	} {
+		c, err := parseColor(test.color)
+		if err != nil {
+			t.Errorf("parseColor(%q): %v", test.color, err)
+		} else if c != test.expected {
+			t.Errorf("parseColor(%q) = %v, expected %v", test.color, c, test.expected)
+		}
+	}
+
+	for _, bad := range []string{
+		"", "#", "#ab", "#abcde", "#1234567", "#ggg",
+		"rgb:1/2", "rgb:12345/0/0", "rgb:/1/2", "rgbi:2/0/0", "rgbi:x/0/0",
+		"rgb(1, 2)", "rgb(1, 2, 3, 4, 5)", "rgb(1, 2, 3", "rgb(a, b, c)", "cmyk(1, 2, 3)",
+		"hsl(red, 50%, 50%)", "hsl(nan, 50%, 50%)", "notacolor",
+	} {
+		if c, err := parseColor(bad); err == nil {
+			t.Errorf("parseColor(%q) = %v, expected an error", bad, c)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+)
+
+var (
+	fromFormat  = new(string)
+	toFormat    = new(string)
+	formatsJSON = new(bool)
+)
+
+// A command is a subcommand of schemer2, with the options that apply to it
+type command struct {
+	name    string
+	summary string
+	args    string // Positional arguments, for the usage line
+	groups  []flagGroup
+	run     func(args []string) error
+	// Whether run parses the options itself, for commands whose options may
+	// come before and after their arguments
+	ownFlags bool
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{
+			name:    "convert",
+			summary: "Convert a color scheme from one terminal's config to another's",
+			groups:  []flagGroup{convertFlags, ioFlags, presetFlags, hookFlags, watchFlags, liveInputFlags, fileOutputFlags, oscOutputFlags},
+			run:     convertCommand,
+		},
+		{
+			name:    "extract",
+			summary: "Extract a color scheme from an image",
+			groups:  []flagGroup{extractFlags, ioFlags, presetFlags, hookFlags, watchFlags, imageInputFlags, fileOutputFlags, oscOutputFlags},
+			run:     extractCommand,
+		},
+		{
+			name:    "generate",
+			summary: "Generate a wallpaper from a color scheme",
+			groups:  []flagGroup{generateFlags, ioFlags, presetFlags, hookFlags, watchFlags, imageInputFlags, liveInputFlags, fileOutputFlags, oscOutputFlags, imageOutputFlags, overlayFlags, monitorFlags, circlesFlags, raysFlags, stripesFlags},
+			run:     generateCommand,
+		},
+		{
+			name:    "preview",
+			summary: "Show a color scheme as 24-bit color swatches and sample text in the terminal",
+			groups:  []flagGroup{readFlags, presetFlags, imageInputFlags, liveInputFlags},
+			run:     previewCommand,
+		},
+		{
+			name:    "check",
+			summary: "Check that a color scheme can be read",
+			groups:  []flagGroup{readFlags, presetFlags, imageInputFlags, liveInputFlags},
+			run:     checkCommand,
+		},
+		{
+			name:    "compare",
+			summary: "Compare two color schemes slot by slot, by how different their colors look",
+			args:    "FILE1 FILE2",
+			groups:  []flagGroup{compareFlags, presetFlags, imageInputFlags},
+			run:     compareCommand,
+		},
+		{
+			name:    "formats",
+			summary: "List the supported input and output formats",
+			groups:  []flagGroup{formatsFlags},
+			run:     formatsCommand,
+		},
+		{
+			name:     "config",
+			summary:  "Show the options in effect after reading the config file and presets",
+			args:     "dump",
+			groups:   flagGroups,
+			run:      configCommand,
+			ownFlags: true,
+		},
+		{
+			name:    "restore",
+			summary: "List backups of config files, or restore one",
+			args:    "[FILE] [N]",
+			run:     restoreCommand,
+		},
+		{
+			name:    "help",
+			summary: "Show the options of a command",
+			args:    "[COMMAND]",
+			run:     helpCommand,
+		},
+	}
+}
+
+var convertFlags = flagGroup{"Convert", func(fs *flag.FlagSet) {
+	fs.StringVar(fromFormat, "from", "", "Format of the input file. Eg. 'xterm'")
+	fs.StringVar(toFormat, "to", "", "Formats to write, separated by commas. Eg. 'kitty,xterm'")
+}}
+
+var extractFlags = flagGroup{"Extract", func(fs *flag.FlagSet) {
+	fs.StringVar(toFormat, "to", "colors", "Formats to write, separated by commas. Eg. 'kitty,xterm'")
+}}
+
+var generateFlags = flagGroup{"Generate", func(fs *flag.FlagSet) {
+	fs.StringVar(fromFormat, "from", "", "Format of the input file. Eg. 'xterm'")
+	fs.StringVar(toFormat, "to", "img", "Formats to write, separated by commas: 'img' for PNG, 'svg', and terminal formats to write from the same colors. Eg. 'img,kitty'")
+}}
+
+var formatsFlags = flagGroup{"Formats", func(fs *flag.FlagSet) {
+	fs.BoolVar(formatsJSON, "json", false, "List the formats as JSON, with their file extensions, special colors and default config paths")
+}}
+
+// Options for commands that only read a scheme
+var readFlags = flagGroup{"Input", func(fs *flag.FlagSet) {
+	fs.StringVar(fromFormat, "from", "", "Format of the input file. Eg. 'xterm'")
+	fs.StringVar(infile, "in", "", "Input file")
+}}
+
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+func commandUsage(c command, fs *flag.FlagSet) {
+	line := "Usage: schemer2 " + c.name
+	if c.args != "" {
+		line += " " + c.args
+	}
+	if len(c.groups) > 0 {
+		line += " [FLAGS]"
+	}
+	fmt.Println(line)
+	fmt.Println()
+	fmt.Println(c.summary)
+	fmt.Println()
+	printGroups(fs, c.groups)
+}
+
+// runCommand parses the options of a subcommand, and runs it
+func runCommand(name string, args []string) error {
+	c, ok := findCommand(name)
+	if !ok {
+		usage()
+		return errors.New("Unknown command: " + name)
+	}
+	if c.ownFlags {
+		return c.run(args)
+	}
+	fs := flag.NewFlagSet("schemer2 "+c.name, flag.ExitOnError)
+	for _, g := range c.groups {
+		g.register(fs)
+	}
+	fs.Usage = func() {
+		commandUsage(c, fs)
+	}
+	fs.Parse(args)
+
+	if fs.Lookup("preset") != nil {
+		_, err := applyConfig(fs)
+		if err != nil {
+			return err
+		}
+	}
+	err := validateOptions()
+	if err != nil {
+		return err
+	}
+	return c.run(fs.Args())
+}
+
+// requireInput checks that the input options needed to read a scheme were given
+func requireInput() error {
+	if *fromFormat == "" {
+		return errors.New("Input format must be specified using '-from' flag.")
+	}
+	// Live input defaults to the current terminal
+	if *infile == "" && *fromFormat != "live" {
+		return errors.New("Input file must be provided using '-in' flag.")
+	}
+	return nil
+}
+
+func convertCommand(args []string) error {
+	err := requireInput()
+	if err != nil {
+		return err
+	}
+	if *toFormat == "" && *manifestFile == "" {
+		return errors.New("Output format must be specified using '-to' flag.")
+	}
+	if *fromFormat == "img" {
+		return errors.New("Use 'schemer2 extract' to read colors from an image.")
+	}
+	targets, err := configTargets()
+	if err != nil {
+		return err
+	}
+	return runOrWatch(*fromFormat, *infile, targets)
+}
+
+// configTargets returns the outputs given by -to, -out and -manifest,
+// which mustn't include images.
+func configTargets() ([]outputTarget, error) {
+	targets, err := outputTargets(*toFormat, *outfile, *manifestFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range targets {
+		if isImageFormat(t.format) {
+			return nil, errors.New("Use 'schemer2 generate' to write an image.")
+		}
+	}
+	return targets, nil
+}
+
+func extractCommand(args []string) error {
+	if *infile == "" {
+		return errors.New("Input image must be provided using '-in' flag.")
+	}
+	targets, err := configTargets()
+	if err != nil {
+		return err
+	}
+	return runOrWatch("img", *infile, targets)
+}
+
+func generateCommand(args []string) error {
+	err := requireInput()
+	if err != nil {
+		return err
+	}
+	targets, err := outputTargets(*toFormat, *outfile, *manifestFile)
+	if err != nil {
+		return err
+	}
+	return runOrWatch(*fromFormat, *infile, targets)
+}
+
+func previewCommand(args []string) error {
+	err := requireInput()
+	if err != nil {
+		return err
+	}
+	colors, err := readColors(*fromFormat, *infile)
+	if err != nil {
+		return err
+	}
+	fmt.Print(printPreview(colors))
+	return nil
+}
+
+func checkCommand(args []string) error {
+	err := requireInput()
+	if err != nil {
+		return err
+	}
+	f, ok := findFormat(*fromFormat)
+	if !ok || f.input == nil {
+		return errors.New("Unrecognised input format: " + *fromFormat)
+	}
+	colors, err := f.input(*infile)
+	if err != nil {
+		return err
+	}
+	if len(colors) == 0 {
+		return errors.New("No colors found in " + *infile)
+	}
+	fmt.Printf("Read %d colors from %v\n", len(colors), *infile)
+	if len(colors) < 16 {
+		fmt.Println("Warning: fewer than 16 colors, so the scheme will be repeated to fill the palette")
+	} else if len(colors) > 16 {
+		fmt.Println("Warning: more than 16 colors, so only the first 16 will be used")
+	}
+	return nil
+}
+
+// formatInfo describes a format in the JSON listing of formats
+type formatInfo struct {
+	Name          string   `json:"name"`
+	Flag          string   `json:"flag"`
+	Read          bool     `json:"read"`
+	Write         bool     `json:"write"`
+	Merge         bool     `json:"merge"`
+	Extensions    []string `json:"extensions"`
+	SpecialColors []string `json:"special_colors"`
+	ConfigPaths   []string `json:"config_paths"`
+}
+
+// nonNil makes sure empty lists are written as [] rather than null
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
+
+func formatsCommand(args []string) error {
+	if !*formatsJSON {
+		inputs_outputs()
+		return nil
+	}
+	infos := make([]formatInfo, 0, len(formats))
+	for _, f := range formats {
+		infos = append(infos, formatInfo{
+			Name:          f.friendlyName,
+			Flag:          f.flagName,
+			Read:          f.input != nil,
+			Write:         f.output != nil || f.render != nil,
+			Merge:         f.merge != nil,
+			Extensions:    nonNil(f.extensions),
+			SpecialColors: nonNil(f.specialColors),
+			ConfigPaths:   nonNil(f.configPaths),
+		})
+	}
+	out, err := json.MarshalIndent(infos, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+func helpCommand(args []string) error {
+	if len(args) == 0 {
+		usage()
+		return nil
+	}
+	c, ok := findCommand(args[0])
+	if !ok {
+		return errors.New("Unknown command: " + args[0])
+	}
+	fs := flag.NewFlagSet("schemer2 "+c.name, flag.ContinueOnError)
+	for _, g := range c.groups {
+		g.register(fs)
+	}
+	commandUsage(c, fs)
+	return nil
+}
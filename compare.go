@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+var (
+	compareFrom2 = new(string)
+	compareOut   = new(string)
+)
+
+var compareFlags = flagGroup{"Compare", func(fs *flag.FlagSet) {
+	fs.StringVar(fromFormat, "from", "", "Format of both files. Eg. 'xterm'")
+	fs.StringVar(compareFrom2, "from2", "", "Format of the second file, if it differs from the first")
+	fs.StringVar(compareOut, "out", "", "Also draw the comparison to this PNG file")
+	fs.BoolVar(backup, "backup", true, "Back up the -out file before replacing it. Restore backups with 'schemer2 restore'")
+}}
+
+// A labColor is a color in the CIE L*a*b* color space, under a D65 white point
+type labColor struct {
+	L, a, b float64
+}
+
+// toLab converts an sRGB color to CIE L*a*b*
+func toLab(c color.Color) labColor {
+	cc := nrgba(c)
+	linear := func(v uint8) float64 {
+		f := float64(v) / 255
+		if f <= 0.04045 {
+			return f / 12.92
+		}
+		return math.Pow((f+0.055)/1.055, 2.4)
+	}
+	r, g, b := linear(cc.R), linear(cc.G), linear(cc.B)
+
+	// To XYZ, relative to the D65 white point
+	x := (0.4124564*r + 0.3575761*g + 0.1804375*b) / 0.95047
+	y := (0.2126729*r + 0.7151522*g + 0.0721750*b) / 1.0
+	z := (0.0193339*r + 0.1191920*g + 0.9503041*b) / 1.08883
+
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27*t + 16) / 116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return labColor{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+func degrees(radians float64) float64 {
+	return radians * 180 / math.Pi
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+// ciede2000 returns the CIEDE2000 color difference between two colors.
+// A difference below 1 can't be seen, and below 2 only on close inspection.
+func ciede2000(lab1 labColor, lab2 labColor) float64 {
+	const pow25to7 = 6103515625.0 // 25^7
+
+	c1 := math.Hypot(lab1.a, lab1.b)
+	c2 := math.Hypot(lab2.a, lab2.b)
+	cBar7 := math.Pow((c1+c2)/2, 7)
+	g := 0.5 * (1 - math.Sqrt(cBar7/(cBar7+pow25to7)))
+	a1 := (1 + g) * lab1.a
+	a2 := (1 + g) * lab2.a
+	c1 = math.Hypot(a1, lab1.b)
+	c2 = math.Hypot(a2, lab2.b)
+
+	hue := func(b, a float64) float64 {
+		if a == 0 && b == 0 {
+			return 0
+		}
+		h := degrees(math.Atan2(b, a))
+		if h < 0 {
+			h += 360
+		}
+		return h
+	}
+	h1 := hue(lab1.b, a1)
+	h2 := hue(lab2.b, a2)
+
+	deltaL := lab2.L - lab1.L
+	deltaC := c2 - c1
+	deltah := 0.0
+	if c1*c2 != 0 {
+		deltah = h2 - h1
+		if deltah > 180 {
+			deltah -= 360
+		} else if deltah < -180 {
+			deltah += 360
+		}
+	}
+	deltaH := 2 * math.Sqrt(c1*c2) * math.Sin(radians(deltah)/2)
+
+	lBar := (lab1.L + lab2.L) / 2
+	cBar := (c1 + c2) / 2
+	hBar := h1 + h2
+	if c1*c2 != 0 {
+		if math.Abs(h1-h2) <= 180 {
+			hBar /= 2
+		} else if h1+h2 < 360 {
+			hBar = (hBar + 360) / 2
+		} else {
+			hBar = (hBar - 360) / 2
+		}
+	}
+
+	t := 1 - 0.17*math.Cos(radians(hBar-30)) + 0.24*math.Cos(radians(2*hBar)) +
+		0.32*math.Cos(radians(3*hBar+6)) - 0.20*math.Cos(radians(4*hBar-63))
+	deltaTheta := 30 * math.Exp(-math.Pow((hBar-275)/25, 2))
+	cBar7 = math.Pow(cBar, 7)
+	rC := 2 * math.Sqrt(cBar7/(cBar7+pow25to7))
+	lBar50 := (lBar - 50) * (lBar - 50)
+	sL := 1 + 0.015*lBar50/math.Sqrt(20+lBar50)
+	sC := 1 + 0.045*cBar
+	sH := 1 + 0.015*cBar*t
+	rT := -math.Sin(radians(2*deltaTheta)) * rC
+
+	return math.Sqrt(math.Pow(deltaL/sL, 2) + math.Pow(deltaC/sC, 2) + math.Pow(deltaH/sH, 2) +
+		rT*(deltaC/sC)*(deltaH/sH))
+}
+
+// colorDistance returns the CIEDE2000 difference between two colors
+func colorDistance(c1 color.Color, c2 color.Color) float64 {
+	return ciede2000(toLab(c1), toLab(c2))
+}
+
+// differenceVerdict describes how visible a CIEDE2000 difference is
+func differenceVerdict(delta float64) string {
+	switch {
+	case delta < 1:
+		return "identical"
+	case delta < 2:
+		return "close"
+	case delta < 10:
+		return "noticeable"
+	}
+	return "different"
+}
+
+// compareReport lists both colors of each slot, with their difference
+func compareReport(nameA string, a []color.Color, nameB string, b []color.Color) string {
+	output := fmt.Sprintf("A: %v\nB: %v\n\n", nameA, nameB)
+	output += fmt.Sprintf("%-18v %-9v %-9v %8v  %v\n", "Slot", "A", "B", "ΔE00", "Verdict")
+	identical, worst := 0, 0.0
+	for i := range a {
+		delta := colorDistance(a[i], b[i])
+		if delta < 1 {
+			identical++
+		}
+		worst = math.Max(worst, delta)
+		output += fmt.Sprintf("%-18v %-9v %-9v %8.2f  %v\n", fmt.Sprintf("%d %v", i, slotName(i)), svgColor(a[i]), svgColor(b[i]), delta, differenceVerdict(delta))
+	}
+	output += fmt.Sprintf("\n%d of %d colors are perceptually identical. Largest difference: %.2f (%v)\n", identical, len(a), worst, differenceVerdict(worst))
+	return output
+}
+
+// renderComparison draws the colors of each slot of both schemes side by side
+func renderComparison(a []color.Color, b []color.Color) image.Image {
+	line := lineAdvance * swatchScale
+	rowHeight := swatchBlockSize/2 + 8
+	blockWidth := 3 * swatchBlockSize / 2
+	labelWidth := 12 * glyphAdvance * swatchScale
+	width := 2*swatchMargin + labelWidth + 2*blockWidth + swatchCellGap + 24*glyphAdvance*swatchScale
+	height := 2*swatchMargin + line + len(a)*rowHeight
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	fillRect(img, img.Bounds(), swatchPage)
+	x := swatchMargin + labelWidth
+	drawText(img, x, swatchMargin, "A", swatchText, swatchScale)
+	drawText(img, x+blockWidth+swatchCellGap, swatchMargin, "B", swatchText, swatchScale)
+
+	for i := range a {
+		y := swatchMargin + line + i*rowHeight
+		textY := y + (swatchBlockSize/2-glyphHeight*swatchScale)/2
+		drawText(img, swatchMargin, textY, fmt.Sprintf("%d %v", i, slotNames[i%8]), swatchText, swatchScale)
+		for j, c := range []color.Color{a[i], b[i]} {
+			bx := x + j*(blockWidth+swatchCellGap)
+			block := image.Rect(bx, y, bx+blockWidth, y+swatchBlockSize/2)
+			fillRect(img, block, swatchBorder)
+			fillRect(img, block.Inset(1), c)
+		}
+		delta := colorDistance(a[i], b[i])
+		drawText(img, x+2*blockWidth+2*swatchCellGap, textY, fmt.Sprintf("%6.2f %v", delta, differenceVerdict(delta)), swatchText, swatchScale)
+	}
+	return img
+}
+
+// compareCommand reports how two schemes differ, slot by slot
+func compareCommand(args []string) error {
+	if len(args) != 2 {
+		return errors.New("Two files must be given to compare, Eg. 'schemer2 compare -from xterm a.Xresources b.Xresources'")
+	}
+	if *fromFormat == "" {
+		return errors.New("Input format must be specified using '-from' flag.")
+	}
+	from2 := *compareFrom2
+	if from2 == "" {
+		from2 = *fromFormat
+	}
+	a, err := readColors(*fromFormat, args[0])
+	if err != nil {
+		return err
+	}
+	b, err := readColors(from2, args[1])
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(compareReport(args[0], a, args[1], b))
+	if *compareOut != "" {
+		return writeResult(*compareOut, encodePNG(renderComparison(a, b)))
+	}
+	return nil
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A configValue is the value of an option in a config file, in the form
+// given to flag.Set. Options that can be repeated may have several values.
+type configValue struct {
+	values []string
+	source string // File and line it was set on, for error messages
+}
+
+type configTable map[string]configValue
+
+// A Config holds the default options, and named presets of options,
+// read from config files. Keys are the names of command line flags.
+//
+//	threshold = 40
+//
+//	postHook = ["xterm=xrdb -merge {path}", "kitty=kill -USR1 $(pidof kitty)"]
+//
+//	[presets.bokeh]
+//	imageOutType = "circles"
+//	circlesFilled = true
+type Config struct {
+	options configTable
+	presets map[string]configTable
+	files   []string // Files the config was read from
+}
+
+// userConfigPath returns $XDG_CONFIG_HOME/schemer2/config.toml
+func userConfigPath() (string, error) {
+	config := os.Getenv("XDG_CONFIG_HOME")
+	if config == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		config = filepath.Join(home, ".config")
+	}
+	return filepath.Join(config, "schemer2", "config.toml"), nil
+}
+
+// loadConfig reads the user's config file. A config file in the current
+// directory is never read, as options such as -postHook run commands, and
+// the directory may be an untrusted checkout.
+func loadConfig() (Config, error) {
+	cfg := Config{options: make(configTable), presets: make(map[string]configTable)}
+	user, err := userConfigPath()
+	if err != nil {
+		return cfg, err
+	}
+	text, err := readFile(user)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	err = parseConfig(&cfg, text, user)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.files = append(cfg.files, user)
+	return cfg, nil
+}
+
+var (
+	configSection  = regexp.MustCompile(`^\[\s*([^\[\]]*?)\s*\]$`)
+	configPreset   = regexp.MustCompile(`^presets\.(?:([A-Za-z0-9_-]+)|"([^"]*)")$`)
+	configKeyValue = regexp.MustCompile(`^([A-Za-z0-9_-]+)\s*=\s*(.*)$`)
+	configNumber   = regexp.MustCompile(`^[+-]?[0-9][0-9_]*(\.[0-9_]+)?([eE][+-]?[0-9]+)?$`)
+)
+
+// parseConfig reads the options in text into cfg.
+// Only the parts of TOML needed for options are supported: top level keys,
+// [presets.NAME] tables, and string, number and boolean values, and arrays of
+// strings for options that can be repeated.
+func parseConfig(cfg *Config, text string, filename string) error {
+	table := cfg.options
+	for i, line := range strings.Split(text, "\n") {
+		source := filename + ":" + strconv.Itoa(i+1)
+		line = strings.TrimSpace(stripConfigComment(line))
+		if line == "" {
+			continue
+		}
+
+		if m := configSection.FindStringSubmatch(line); m != nil {
+			p := configPreset.FindStringSubmatch(m[1])
+			if p == nil {
+				return errors.New(source + ": Unknown section [" + m[1] + "]. Sections must be presets, Eg. [presets.bokeh]")
+			}
+			name := p[1] + p[2]
+			if cfg.presets[name] == nil {
+				cfg.presets[name] = make(configTable)
+			}
+			table = cfg.presets[name]
+			continue
+		}
+
+		m := configKeyValue.FindStringSubmatch(line)
+		if m == nil {
+			return errors.New(source + ": Expected 'option = value'")
+		}
+		values := make([]string, 0)
+		var err error
+		if strings.HasPrefix(m[2], "[") {
+			values, err = parseConfigArray(m[2])
+		} else {
+			var value string
+			value, err = parseConfigValue(m[2])
+			values = append(values, value)
+		}
+		if err != nil {
+			return errors.New(source + ": " + err.Error())
+		}
+		table[m[1]] = configValue{values, source}
+	}
+	return nil
+}
+
+// stripConfigComment removes a # comment from the end of a line,
+// leaving any # inside a string alone.
+func stripConfigComment(line string) string {
+	var quote rune
+	escaped := false
+	for i, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// parseConfigValue converts a TOML value to the text of a flag value
+func parseConfigValue(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		s, err := strconv.Unquote(value)
+		if err != nil {
+			return "", errors.New("Invalid string " + value)
+		}
+		return s, nil
+	case strings.HasPrefix(value, `'`):
+		if len(value) < 2 || !strings.HasSuffix(value, `'`) || strings.Contains(value[1:len(value)-1], `'`) {
+			return "", errors.New("Invalid string " + value)
+		}
+		return value[1 : len(value)-1], nil
+	case value == "true" || value == "false":
+		return value, nil
+	case configNumber.MatchString(value):
+		return strings.Replace(value, "_", "", -1), nil
+	}
+	return "", errors.New("Unsupported value " + value + ". Values must be strings, numbers or booleans")
+}
+
+// parseConfigArray converts a TOML array of strings to the values of a flag
+// that can be repeated, Eg. ["a", 'b']
+func parseConfigArray(array string) ([]string, error) {
+	if !strings.HasSuffix(array, "]") {
+		return nil, errors.New("Invalid array " + array)
+	}
+	rest := strings.TrimSpace(array[1 : len(array)-1])
+	values := make([]string, 0)
+	for rest != "" {
+		// Find the end of the string, skipping escaped quotes
+		end := -1
+		switch rest[0] {
+		case '"':
+			for i := 1; i < len(rest) && end < 0; i++ {
+				if rest[i] == '\\' {
+					i++
+				} else if rest[i] == '"' {
+					end = i
+				}
+			}
+		case '\'':
+			if i := strings.Index(rest[1:], "'"); i >= 0 {
+				end = i + 1
+			}
+		}
+		if end < 0 {
+			return nil, errors.New("Invalid array " + array + ". Arrays must hold strings")
+		}
+		value, err := parseConfigValue(rest[:end+1])
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		rest = strings.TrimSpace(rest[end+1:])
+		if rest != "" && !strings.HasPrefix(rest, ",") {
+			return nil, errors.New("Expected ',' between the values of " + array)
+		}
+		rest = strings.TrimSpace(strings.TrimPrefix(rest, ","))
+	}
+	return values, nil
+}
+
+// knownOption reports whether name is an option of any command
+func knownOption(name string) bool {
+	for _, names := range groupFlagNames {
+		for _, n := range names {
+			if n == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// applyConfig sets the options in fs from the config files, and then from
+// the preset chosen with -preset. Options given on the command line are left
+// alone, and options that fs doesn't have are skipped, so one config file
+// can hold options for every command.
+func applyConfig(fs *flag.FlagSet) (Config, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return cfg, err
+	}
+	setOnCommandLine := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		setOnCommandLine[f.Name] = true
+	})
+
+	apply := func(table configTable) error {
+		for name, v := range table {
+			if !knownOption(name) || name == "preset" {
+				return errors.New(v.source + ": Unknown option " + name)
+			}
+			if setOnCommandLine[name] || fs.Lookup(name) == nil {
+				continue
+			}
+			for _, value := range v.values {
+				err := fs.Set(name, value)
+				if err != nil {
+					return errors.New(v.source + ": Invalid value for " + name + ": " + err.Error())
+				}
+			}
+		}
+		return nil
+	}
+
+	err = apply(cfg.options)
+	if err != nil {
+		return cfg, err
+	}
+	if *preset != "" {
+		table, ok := cfg.presets[*preset]
+		if !ok {
+			return cfg, errors.New("Unknown preset: " + *preset)
+		}
+		err = apply(table)
+		if err != nil {
+			return cfg, err
+		}
+	}
+	return cfg, nil
+}
+
+// configDump returns the value of every option in fs as a TOML config file
+func configDump(fs *flag.FlagSet, groups []flagGroup, cfg Config) string {
+	output := "# Effective options"
+	if *preset != "" {
+		output += ", with preset " + *preset
+	}
+	output += "\n"
+	for _, f := range cfg.files {
+		output += "# Read from " + f + "\n"
+	}
+	for _, g := range groups {
+		names := append([]string{}, groupFlagNames[g.name]...)
+		sort.Strings(names)
+		output += "\n# " + g.name + " options\n"
+		for _, name := range names {
+			f := fs.Lookup(name)
+			if f == nil || name == "preset" {
+				continue
+			}
+			value, ok := configFormatValue(f)
+			if ok {
+				output += name + " = " + value + "\n"
+			}
+		}
+	}
+	return output
+}
+
+// A repeatableValue is the value of a flag that can be given several times
+type repeatableValue interface {
+	flag.Value
+	// list returns each value the flag was given, in the form given to Set
+	list() []string
+}
+
+// configFormatValue formats the value of a flag as a TOML value. Flags that
+// can be repeated are written as an array, and left out when they are empty.
+func configFormatValue(f *flag.Flag) (string, bool) {
+	if r, ok := f.Value.(repeatableValue); ok {
+		values := r.list()
+		if len(values) == 0 {
+			return "", false
+		}
+		for i, v := range values {
+			values[i] = strconv.Quote(v)
+		}
+		return "[" + strings.Join(values, ", ") + "]", true
+	}
+	value := f.Value.String()
+	if getter, ok := f.Value.(flag.Getter); ok {
+		switch getter.Get().(type) {
+		case bool, int, int64, float64:
+			return value, true
+		}
+	}
+	return strconv.Quote(value), true
+}
+
+// configCommand prints the options in effect. Options may be given before
+// or after "dump", and are parsed into one set so that none are lost.
+func configCommand(args []string) error {
+	c, _ := findCommand("config")
+	fs := flag.NewFlagSet("schemer2 config", flag.ExitOnError)
+	for _, g := range c.groups {
+		g.register(fs)
+	}
+	fs.Usage = func() {
+		commandUsage(c, fs)
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 || fs.Arg(0) != "dump" {
+		return errors.New("Usage: schemer2 config dump [FLAGS]")
+	}
+	fs.Parse(fs.Args()[1:])
+	if fs.NArg() > 0 {
+		return errors.New("Unexpected argument: " + fs.Arg(0))
+	}
+	cfg, err := applyConfig(fs)
+	if err != nil {
+		return err
+	}
+	fmt.Print(configDump(fs, c.groups, cfg))
+	return nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStripConfigComment(t *testing.T) {
+	for _, test := range []struct {
+		line     string
+		expected string
+	}{
+		{"threshold = 40", "threshold = 40"},
+		{"threshold = 40 # more colors", "threshold = 40 "},
+		{"# a comment", ""},
+		{`out = "theme#1.conf" # kitty`, `out = "theme#1.conf" `},
+		{`out = 'theme#1.conf'`, `out = 'theme#1.conf'`},
+		{`out = "a \"#\" b" # c`, `out = "a \"#\" b" `},
+	} {
+		if got := stripConfigComment(test.line); got != test.expected {
+			t.Errorf("stripConfigComment(%q) = %q, expected %q", test.line, got, test.expected)
+		}
+	}
+}
+
+func TestParseConfigValue(t *testing.T) {
+	for _, test := range []struct {
+		value    string
+		expected string
+	}{
+		{`"circles"`, "circles"},
+		{`"a \"quoted\" word"`, `a "quoted" word`},
+		{`'C:\path'`, `C:\path`},
+		{"true", "true"},
+		{"false", "false"},
+		{"40", "40"},
+		{"-1.5", "-1.5"},
+		{"1_000", "1000"},
+		{"2e3", "2e3"},
+	} {
+		got, err := parseConfigValue(test.value)
+		if err != nil {
+			t.Errorf("parseConfigValue(%v): %v", test.value, err)
+		} else if got != test.expected {
+			t.Errorf("parseConfigValue(%v) = %q, expected %q", test.value, got, test.expected)
+		}
+	}
+	for _, value := range []string{"circles", `"unterminated`, `'it's'`, "[1, 2]", "{a = 1}", "1980-01-01"} {
+		if _, err := parseConfigValue(value); err == nil {
+			t.Errorf("parseConfigValue(%v) should fail", value)
+		}
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	text := strings.Join([]string{
+		"# Defaults",
+		"threshold = 40",
+		`postHook = ["xterm=xrdb -merge {path}", 'kitty=kill -USR1 $(pidof kitty)']`,
+		"",
+		"[presets.bokeh]",
+		`imageOutType = "circles" # blurry`,
+		"circlesFilled = true",
+		`[presets."wide rays"]`,
+		"raysSize = 30",
+	}, "\n")
+	cfg := Config{options: make(configTable), presets: make(map[string]configTable)}
+	err := parseConfig(&cfg, text, "config.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]string{
+		"threshold": {"40"},
+		"postHook":  {"xterm=xrdb -merge {path}", "kitty=kill -USR1 $(pidof kitty)"},
+	}
+	for name, values := range expected {
+		if !reflect.DeepEqual(cfg.options[name].values, values) {
+			t.Errorf("%v is %q, expected %q", name, cfg.options[name].values, values)
+		}
+	}
+	if cfg.options["threshold"].source != "config.toml:2" {
+		t.Errorf("threshold was read from %v, expected config.toml:2", cfg.options["threshold"].source)
+	}
+	if v := cfg.presets["bokeh"]["imageOutType"].values; !reflect.DeepEqual(v, []string{"circles"}) {
+		t.Errorf("Preset bokeh has imageOutType %q", v)
+	}
+	if v := cfg.presets["wide rays"]["raysSize"].values; !reflect.DeepEqual(v, []string{"30"}) {
+		t.Errorf("Preset 'wide rays' has raysSize %q", v)
+	}
+
+	for _, bad := range []string{"[colors]", "threshold", "threshold = circles", `postHook = ["a" "b"]`, "postHook = [1, 2]"} {
+		cfg := Config{options: make(configTable), presets: make(map[string]configTable)}
+		if err := parseConfig(&cfg, bad, "config.toml"); err == nil {
+			t.Errorf("parseConfig(%q) should fail", bad)
+		}
+	}
+}
+
+// setUserConfig makes text the user's config file for a test
+func setUserConfig(t *testing.T, text string) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	err := os.MkdirAll(filepath.Join(dir, "schemer2"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "schemer2", "config.toml"), []byte(text), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// configFlagSet registers every option on a new flag set, as the config
+// command does, setting them all to their defaults
+func configFlagSet() *flag.FlagSet {
+	registerDefaults()
+	for format := range postHooks {
+		delete(postHooks, format)
+	}
+	*preset = ""
+	fs := flag.NewFlagSet("schemer2 config", flag.ContinueOnError)
+	for _, g := range flagGroups {
+		g.register(fs)
+	}
+	return fs
+}
+
+func TestApplyConfigPresets(t *testing.T) {
+	setUserConfig(t, strings.Join([]string{
+		"threshold = 40",
+		"minBright = 10",
+		`imageOutType = "rays"`,
+		"[presets.bokeh]",
+		`imageOutType = "circles"`,
+		"threshold = 60",
+	}, "\n"))
+	t.Cleanup(func() { configFlagSet() })
+
+	fs := configFlagSet()
+	err := fs.Parse([]string{"-preset", "bokeh", "-threshold", "70"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = applyConfig(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The command line wins over the preset, which wins over the defaults
+	// in the config file
+	if *threshold != 70 || *minBrightness != 10 || *imageOutType != "circles" {
+		t.Errorf("threshold = %v, minBright = %v, imageOutType = %v, expected 70, 10 and circles", *threshold, *minBrightness, *imageOutType)
+	}
+
+	fs = configFlagSet()
+	fs.Parse([]string{"-preset", "missing"})
+	if _, err = applyConfig(fs); err == nil {
+		t.Error("Expected an error for an unknown preset")
+	}
+}
+
+// TestConfigDumpLoads checks that the output of config dump can be used as
+// the config file, giving the same options.
+func TestConfigDumpLoads(t *testing.T) {
+	setUserConfig(t, "")
+	t.Cleanup(func() { configFlagSet() })
+
+	fs := configFlagSet()
+	err := fs.Parse([]string{"-threshold", "42", "-out", "theme #1.conf", "-postHook", "xterm=xrdb -merge {path}", "-postHook", `kitty=echo "a, b"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := applyConfig(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dump := configDump(fs, flagGroups, cfg)
+
+	setUserConfig(t, dump)
+	fs = configFlagSet()
+	cfg, err = applyConfig(fs)
+	if err != nil {
+		t.Fatalf("Loading the dump failed: %v\n%v", err, dump)
+	}
+	reloaded := configDump(fs, flagGroups, cfg)
+
+	withoutComments := func(text string) string {
+		lines := make([]string, 0)
+		for _, l := range strings.Split(text, "\n") {
+			if !strings.HasPrefix(l, "#") {
+				lines = append(lines, l)
+			}
+		}
+		return strings.Join(lines, "\n")
+	}
+	if withoutComments(reloaded) != withoutComments(dump) {
+		t.Errorf("Loading the dump changed the options\n%v", unifiedDiff("config.toml", withoutComments(dump), withoutComments(reloaded)))
+	}
+	if len(postHooks) != 2 || postHooks["kitty"] != `echo "a, b"` {
+		t.Errorf("Hooks loaded as %v", postHooks)
+	}
+
+	// With no hooks, the dump leaves them out rather than writing an empty value
+	fs = configFlagSet()
+	if strings.Contains(configDump(fs, flagGroups, Config{}), "postHook") {
+		t.Error("Dump includes postHook when there are no hooks")
+	}
+}
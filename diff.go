@@ -0,0 +1,198 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Number of unchanged lines shown around each change
+const diffContext = 3
+
+type diffLine struct {
+	op   byte // ' ', '-' or '+'
+	text string
+}
+
+// splitLines splits text into lines, without a trailing empty line
+func splitLines(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// Marks a last line with no newline, as diff does, so that adding or
+// removing the newline shows as a change
+const noNewline = "\n\\ No newline at end of file"
+
+// fileLines splits a file into lines, marking a last line with no newline
+func fileLines(text string) []string {
+	lines := splitLines(text)
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		lines[len(lines)-1] += noNewline
+	}
+	return lines
+}
+
+// diffLines finds the changes from a to b. Lines the same at the start and
+// end of both are kept as they are, and the longest common subsequence of
+// the rest is found, so that a small change to a large file is quick.
+func diffLines(a []string, b []string) []diffLine {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]diffLine, 0, len(a)+len(b))
+	for _, l := range a[:prefix] {
+		lines = append(lines, diffLine{' ', l})
+	}
+	lines = append(lines, diffSubsequence(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, l := range a[len(a)-suffix:] {
+		lines = append(lines, diffLine{' ', l})
+	}
+	return lines
+}
+
+// diffSubsequence finds the changes from a to b, using the longest common
+// subsequence
+func diffSubsequence(a []string, b []string) []diffLine {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	lines := make([]diffLine, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] > lcs[i+1][j]):
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		default:
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		}
+	}
+	return lines
+}
+
+// hunkRange formats the start and length of a hunk, as in "@@ -1,4 +1,5 @@"
+func hunkRange(start int, length int) string {
+	if length == 0 {
+		return strconv.Itoa(start) + ",0"
+	}
+	return strconv.Itoa(start+1) + "," + strconv.Itoa(length)
+}
+
+// isBinary reports whether text is binary data, such as an image, rather than text
+func isBinary(text string) bool {
+	return strings.IndexByte(text, 0) >= 0 || !utf8.ValidString(text)
+}
+
+// unifiedDiff returns the differences between two versions of a file in
+// unified diff format, or "" if they are the same.
+func unifiedDiff(filename string, before string, after string) string {
+	lines := diffLines(fileLines(before), fileLines(after))
+
+	changed := false
+	for _, l := range lines {
+		if l.op != ' ' {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return ""
+	}
+
+	output := "--- " + filename + "\n"
+	output += "+++ " + filename + " (schemer2)\n"
+
+	// Line numbers in before and after, at each line of the diff
+	aLine, bLine := 0, 0
+	for start := 0; start < len(lines); {
+		// Find the next change
+		for start < len(lines) && lines[start].op == ' ' {
+			start++
+			aLine++
+			bLine++
+		}
+		if start == len(lines) {
+			break
+		}
+
+		// Extend the hunk until there are enough unchanged lines to end it
+		end := start
+		for end < len(lines) {
+			if lines[end].op != ' ' {
+				end++
+				continue
+			}
+			same := end
+			for same < len(lines) && lines[same].op == ' ' {
+				same++
+			}
+			if same == len(lines) || same-end > 2*diffContext {
+				break
+			}
+			end = same
+		}
+
+		before := start - diffContext
+		if before < 0 {
+			before = 0
+		}
+		after := end + diffContext
+		if after > len(lines) {
+			after = len(lines)
+		}
+
+		aStart, bStart := aLine-(start-before), bLine-(start-before)
+		aLen, bLen := 0, 0
+		hunk := ""
+		for _, l := range lines[before:after] {
+			hunk += string(l.op) + l.text + "\n"
+			if l.op != '+' {
+				aLen++
+			}
+			if l.op != '-' {
+				bLen++
+			}
+		}
+		output += "@@ -" + hunkRange(aStart, aLen) + " +" + hunkRange(bStart, bLen) + " @@\n"
+		output += hunk
+
+		for _, l := range lines[start:end] {
+			if l.op != '+' {
+				aLine++
+			}
+			if l.op != '-' {
+				bLine++
+			}
+		}
+		start = end
+	}
+	return output
+}
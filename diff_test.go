@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// numberedLines returns lines "1" to "n", with line i replaced by changes[i]
+func numberedLines(n int, changes map[int]string) string {
+	lines := make([]string, n)
+	for i := range lines {
+		line, ok := changes[i+1]
+		if !ok {
+			line = strconv.Itoa(i + 1)
+		}
+		lines[i] = line + "\n"
+	}
+	return strings.Join(lines, "")
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	header := "--- f\n+++ f (schemer2)\n"
+	for _, test := range []struct {
+		name     string
+		before   string
+		after    string
+		expected string
+	}{
+		{"identical", "a\nb\n", "a\nb\n", ""},
+		{"both empty", "", "", ""},
+		{"identical without newline", "a\nb", "a\nb", ""},
+		{"insertion", "a\nb\nc\n", "a\nb\nx\nc\n", header + "@@ -1,3 +1,4 @@\n a\n b\n+x\n c\n"},
+		{"deletion", "a\nb\nc\n", "a\nc\n", header + "@@ -1,3 +1,2 @@\n a\n-b\n c\n"},
+		{"new file", "", "a\nb\n", header + "@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"emptied file", "a\n", "", header + "@@ -1,1 +0,0 @@\n-a\n"},
+		{
+			"context",
+			numberedLines(20, nil),
+			numberedLines(20, map[int]string{15: "x"}),
+			header + "@@ -12,7 +12,7 @@\n 12\n 13\n 14\n-15\n+x\n 16\n 17\n 18\n",
+		},
+		{
+			"merged hunks",
+			numberedLines(20, nil),
+			numberedLines(20, map[int]string{2: "x", 9: "y"}),
+			header + "@@ -1,12 +1,12 @@\n 1\n-2\n+x\n 3\n 4\n 5\n 6\n 7\n 8\n-9\n+y\n 10\n 11\n 12\n",
+		},
+		{
+			"separate hunks",
+			numberedLines(20, nil),
+			numberedLines(20, map[int]string{2: "x", 10: "y"}),
+			header + "@@ -1,5 +1,5 @@\n 1\n-2\n+x\n 3\n 4\n 5\n@@ -7,7 +7,7 @@\n 7\n 8\n 9\n-10\n+y\n 11\n 12\n 13\n",
+		},
+		{
+			"newline added",
+			"a\nb", "a\nb\n",
+			header + "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+		{
+			"newline removed",
+			"a\nb\n", "a\nc",
+			header + "@@ -1,2 +1,2 @@\n a\n-b\n+c\n\\ No newline at end of file\n",
+		},
+	} {
+		if got := unifiedDiff("f", test.before, test.after); got != test.expected {
+			t.Errorf("%v: diff is\n%v\nexpected\n%v", test.name, got, test.expected)
+		}
+	}
+}
+
+// TestUnifiedDiffLargeFile checks that a small change to a large file
+// doesn't need a table of every pair of lines.
+func TestUnifiedDiffLargeFile(t *testing.T) {
+	before := numberedLines(100000, nil)
+	after := numberedLines(100000, map[int]string{50000: "x"})
+	diff := unifiedDiff("f", before, after)
+	if !strings.Contains(diff, "@@ -49997,7 +49997,7 @@\n") || strings.Count(diff, "\n") != 11 {
+		t.Errorf("Diff is\n%v", diff)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// File that image output goes to when no file is given, as it can't be
+// written to stdout
+var defaultImageFile = "/tmp/schemer_out.png"
+
+// An outputTarget is one output format, and the file to write it to
+type outputTarget struct {
+	format   string
+	filename string
+	hook     string // Command to run after writing the file
+}
+
+// expandHome replaces a leading ~ in a path with the home directory
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, path[1:]), nil
+}
+
+// formatExtension returns the preferred file extension of a format, without
+// the dot. Formats with no usual extension use their flag name instead.
+func formatExtension(name string) string {
+	f, ok := findFormat(name)
+	if ok && len(f.extensions) > 0 {
+		return strings.TrimPrefix(f.extensions[0], ".")
+	}
+	return name
+}
+
+// expandOutputTemplate replaces {format} and {ext} in an output filename
+func expandOutputTemplate(template string, format string) (string, error) {
+	filename := strings.Replace(template, "{format}", format, -1)
+	filename = strings.Replace(filename, "{ext}", formatExtension(format), -1)
+	return expandHome(filename)
+}
+
+// readManifest reads a manifest file, which lists the file to write each
+// output format to. Outputs with a post_hook are given as a table instead:
+//
+//	kitty = "~/.config/kitty/theme.conf"
+//	img = "~/Pictures/wallpaper.png"
+//
+//	[xterm]
+//	path = "~/.Xresources"
+//	post_hook = "xrdb -merge {path}"
+func readManifest(filename string) ([]outputTarget, error) {
+	text, err := readFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]outputTarget, 0)
+	table := -1 // Index of the output whose table is being read
+	for i, line := range strings.Split(text, "\n") {
+		source := filename + ":" + strconv.Itoa(i+1)
+		line = strings.TrimSpace(stripConfigComment(line))
+		if line == "" {
+			continue
+		}
+		if m := configSection.FindStringSubmatch(line); m != nil {
+			targets = append(targets, outputTarget{format: m[1]})
+			table = len(targets) - 1
+			continue
+		}
+		m := configKeyValue.FindStringSubmatch(line)
+		if m == nil {
+			return nil, errors.New(source + ": Expected 'format = \"file\"'")
+		}
+		value, err := parseConfigValue(m[2])
+		if err != nil {
+			return nil, errors.New(source + ": " + err.Error())
+		}
+		if table < 0 {
+			targets = append(targets, outputTarget{format: m[1], filename: value})
+			continue
+		}
+		switch m[1] {
+		case "path":
+			targets[table].filename = value
+		case "post_hook":
+			targets[table].hook = value
+		default:
+			return nil, errors.New(source + ": Unknown key " + m[1] + ". Outputs have a path and a post_hook")
+		}
+	}
+	for i := range targets {
+		targets[i].filename, err = expandOutputTemplate(targets[i].filename, targets[i].format)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return targets, nil
+}
+
+// outputTargets works out where to write each output format.
+// formatList is a comma separated list of formats, written to outTemplate
+// with {format} and {ext} filled in for each one. Formats listed in the
+// manifest file, if there is one, are added after them.
+func outputTargets(formatList string, outTemplate string, manifest string) ([]outputTarget, error) {
+	targets := make([]outputTarget, 0)
+	names := make([]string, 0)
+	for _, name := range strings.Split(formatList, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 1 && outTemplate != "" && !strings.Contains(outTemplate, "{format}") && !strings.Contains(outTemplate, "{ext}") {
+		return nil, errors.New("Writing several formats to one file. Use {format} or {ext} in the output filename, Eg. 'theme.{ext}'")
+	}
+	for _, name := range names {
+		filename, err := expandOutputTemplate(outTemplate, name)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, outputTarget{format: name, filename: filename})
+	}
+
+	if manifest != "" {
+		manifestTargets, err := readManifest(manifest)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, manifestTargets...)
+	}
+	if len(targets) == 0 {
+		return nil, errors.New("No output formats given")
+	}
+	for i := range targets {
+		if targets[i].hook == "" {
+			targets[i].hook = postHooks[targets[i].format]
+		}
+	}
+
+	written := make(map[string]string)
+	for _, t := range targets {
+		if _, ok := findFormat(t.format); !ok {
+			return nil, errors.New("Did not recognise format " + t.format + ".")
+		}
+		if other, ok := written[t.filename]; ok && t.filename != "" {
+			return nil, errors.New("Both " + other + " and " + t.format + " would be written to " + t.filename)
+		}
+		written[t.filename] = t.format
+	}
+	return targets, nil
+}
+
+// writeOutputs writes the colors to every output target, so that every
+// output of a run comes from the same colors.
+func writeOutputs(colors []color.Color, targets []outputTarget) error {
+	// Pick the seed once, so every image from this run has the same layout
+	if *imageSeed == 0 {
+		*imageSeed = time.Now().UnixNano()
+	}
+	for i, t := range targets {
+		if t.format == "img" && t.filename == "" {
+			fmt.Println("Warning: Image output requested, yet no output file provided.")
+			fmt.Println("Writing image data to " + defaultImageFile)
+			// Hooks are given the file the image was really written to
+			targets[i].filename = defaultImageFile
+			t.filename = defaultImageFile
+		}
+		err := writeColors(t.format, colors, t.filename)
+		if err != nil && len(targets) > 1 {
+			return errors.New(t.format + ": " + err.Error())
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	hooks := false
+	for _, t := range targets {
+		hooks = hooks || t.hook != ""
+	}
+	// Nothing is written when showing changes, so there is nothing to reload
+	if !hooks || *showDiff {
+		return nil
+	}
+	return runHooks(colors, targets)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeManifest writes a manifest file in a temporary directory
+func writeManifest(t *testing.T, lines ...string) string {
+	filename := filepath.Join(t.TempDir(), "manifest.toml")
+	err := ioutil.WriteFile(filename, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestOutputTargets(t *testing.T) {
+	t.Setenv("HOME", "/home/me")
+	registerDefaults()
+	for format := range postHooks {
+		delete(postHooks, format)
+	}
+	postHooks["xterm"] = "xrdb -merge {path}"
+	t.Cleanup(func() { delete(postHooks, "xterm") })
+
+	for _, test := range []struct {
+		formats  string
+		out      string
+		expected []outputTarget
+	}{
+		{"kitty", "", []outputTarget{{format: "kitty"}}},
+		{"kitty", "theme.conf", []outputTarget{{format: "kitty", filename: "theme.conf"}}},
+		{"kitty, xterm", "~/themes/theme.{format}", []outputTarget{
+			{format: "kitty", filename: "/home/me/themes/theme.kitty"},
+			{format: "xterm", filename: "/home/me/themes/theme.xterm", hook: "xrdb -merge {path}"},
+		}},
+		{"kitty,img,,svg", "wal.{ext}", []outputTarget{
+			{format: "kitty", filename: "wal.conf"},
+			{format: "img", filename: "wal.png"},
+			{format: "svg", filename: "wal.svg"},
+		}},
+		{"xterm,kitty", "", []outputTarget{
+			{format: "xterm", hook: "xrdb -merge {path}"},
+			{format: "kitty"},
+		}},
+	} {
+		targets, err := outputTargets(test.formats, test.out, "")
+		if err != nil {
+			t.Errorf("%q to %q: %v", test.formats, test.out, err)
+		} else if !reflect.DeepEqual(targets, test.expected) {
+			t.Errorf("%q to %q gave %+v, expected %+v", test.formats, test.out, targets, test.expected)
+		}
+	}
+
+	for _, test := range []struct {
+		formats string
+		out     string
+		err     string
+	}{
+		{"kitty,xterm", "theme.conf", "Use {format} or {ext}"},
+		{"kitty,xterm", "theme", "Use {format} or {ext}"},
+		{"kitty,nope", "theme.{format}", "Did not recognise format nope"},
+		{"img,svg", "wal.{format}.png", ""},
+		{"konsole,kitty", "theme.{ext}", ""},
+		{" , ", "", "No output formats given"},
+	} {
+		_, err := outputTargets(test.formats, test.out, "")
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%q to %q: %v", test.formats, test.out, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q to %q gave error %v, expected %q", test.formats, test.out, err, test.err)
+		}
+	}
+}
+
+func TestReadManifest(t *testing.T) {
+	t.Setenv("HOME", "/home/me")
+	manifest := writeManifest(t,
+		"# Outputs",
+		`kitty = "~/.config/kitty/theme.conf" # kitty`,
+		`img = '~/Pictures/wallpaper.png'`,
+		"",
+		"[xterm]",
+		`path = "~/.Xresources"`,
+		`post_hook = "xrdb -merge {path}"`,
+		"[svg]",
+		`post_hook = "echo {path}"`,
+	)
+	targets, err := readManifest(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []outputTarget{
+		{format: "kitty", filename: "/home/me/.config/kitty/theme.conf"},
+		{format: "img", filename: "/home/me/Pictures/wallpaper.png"},
+		{format: "xterm", filename: "/home/me/.Xresources", hook: "xrdb -merge {path}"},
+		{format: "svg", hook: "echo {path}"},
+	}
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("Read %+v\nexpected %+v", targets, expected)
+	}
+
+	// Manifest outputs come after the formats given with -format
+	all, err := outputTargets("urxvt", "theme.Xresources", manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 5 || all[0].format != "urxvt" || all[1].format != "kitty" {
+		t.Errorf("Targets are %+v", all)
+	}
+
+	for _, bad := range [][]string{
+		{"kitty"},
+		{"kitty = theme.conf"},
+		{"[xterm]", `file = "x"`},
+		{`kitty = "a.conf"`, `xterm = "a.conf"`},
+	} {
+		_, err := outputTargets("", "", writeManifest(t, bad...))
+		if err == nil {
+			t.Errorf("Manifest %q should fail", bad)
+		}
+	}
+}
@@ -8,10 +8,15 @@ type inputFunction (func(filename string) ([]color.Color, error))
 type outputFunction (func([]color.Color) string)
 
 type Format struct {
-	friendlyName string
-	flagName     string
-	output       outputFunction
-	input        inputFunction
+	friendlyName  string
+	flagName      string
+	output        outputFunction
+	input         inputFunction
+	merge         mergeFunction
+	render        renderFunction // Draws a generated image, for image formats
+	extensions    []string       // Usual file extensions, first is preferred
+	specialColors []string       // Colors besides the 16 color palette, and the background opacity, that are read or written
+	configPaths   []string       // Where the terminal looks for its config by default
 }
 
 var formats = []Format{
@@ -19,82 +24,161 @@ var formats = []Format{
 		friendlyName: "Colors in Plain Text",
 		flagName:     "colors",
 		output:       printColors,
+		extensions:   []string{".txt"},
 	},
 	{
 		friendlyName: "Image",
 		flagName:     "img",
 		input:        colorsFromImage,
+		render:       renderPNG,
+		extensions:   []string{".png", ".jpg", ".jpeg"},
 	},
 	{
-		friendlyName: "XFCE4Terminal",
-		flagName:     "xfce",
-		input:        inputXfce,
-		output:       printXfce,
+		friendlyName: "SVG image",
+		flagName:     "svg",
+		render:       renderSVG,
+		extensions:   []string{".svg"},
+	},
+	{
+		friendlyName: "Palette swatch image",
+		flagName:     "img-swatch",
+		output:       printSwatch,
+		extensions:   []string{".png"},
+	},
+	{
+		friendlyName:  "XFCE4Terminal",
+		flagName:      "xfce",
+		input:         inputXfce,
+		output:        printXfce,
+		merge:         mergeXfce,
+		configPaths:   []string{"~/.config/xfce4/terminal/terminalrc"},
+		specialColors: []string{"background opacity"},
 	},
 	{
 		friendlyName: "LilyTerm",
 		flagName:     "lilyterm",
 		output:       printLilyTerm,
 		input:        inputLilyTerm,
+		merge:        mergeLilyTerm,
+		extensions:   []string{".conf"},
+		configPaths:  []string{"~/.config/lilyterm/default.conf"},
 	},
 	{
-		friendlyName: "Termite",
-		flagName:     "termite",
-		input:        inputTermite,
-		output:       printTermite,
+		friendlyName:  "Termite",
+		flagName:      "termite",
+		input:         inputTermite,
+		output:        printTermite,
+		merge:         mergeTermite,
+		configPaths:   []string{"~/.config/termite/config"},
+		specialColors: []string{"background opacity"},
 	},
 	{
 		friendlyName: "Terminator",
 		flagName:     "terminator",
 		input:        inputTerminator,
 		output:       printTerminator,
+		merge:        mergeTerminator,
+		configPaths:  []string{"~/.config/terminator/config"},
 	},
 	{
 		friendlyName: "ROXTerm",
 		flagName:     "roxterm",
 		output:       printRoxTerm,
+		configPaths:  []string{"~/.config/roxterm.sourceforge.net/Colours/"},
 	},
 	{
-		friendlyName: "rxvt/xterm/aterm",
-		flagName:     "xterm",
-		input:        inputXterm,
-		output:       printXterm,
+		friendlyName:  "rxvt/xterm/aterm",
+		flagName:      "xterm",
+		input:         inputXterm,
+		output:        printXterm,
+		merge:         mergeXterm,
+		configPaths:   []string{"~/.Xresources"},
+		specialColors: []string{"background", "foreground"},
 	},
 	{
-		friendlyName: "Konsole",
-		flagName:     "konsole",
-		output:       printKonsole,
+		friendlyName:  "Konsole",
+		flagName:      "konsole",
+		output:        printKonsole,
+		extensions:    []string{".colorscheme"},
+		configPaths:   []string{"~/.local/share/konsole/"},
+		specialColors: []string{"background opacity"},
 	},
 	{
-		friendlyName: "iTerm2",
-		flagName:     "iterm2",
-		output:       printITerm2,
+		friendlyName:  "iTerm2",
+		flagName:      "iterm2",
+		output:        printITerm2,
+		extensions:    []string{".itermcolors"},
+		specialColors: []string{"background opacity"},
 	},
 	{
-		friendlyName: "urxvt",
-		flagName:     "urxvt",
-		input:        inputXterm,
-		output:       printURxvt,
+		friendlyName:  "urxvt",
+		flagName:      "urxvt",
+		input:         inputURxvt,
+		output:        printURxvt,
+		merge:         mergeXterm,
+		configPaths:   []string{"~/.Xresources"},
+		specialColors: []string{"background opacity"},
 	},
 	{
 		friendlyName: "Chrome Shell",
 		flagName:     "chrome",
 		output:       printChrome,
+		extensions:   []string{".json"},
 	},
 	{
 		friendlyName: "OS X Terminal",
 		flagName:     "osxterminal",
 		output:       printOSXTerminal,
+		extensions:   []string{".terminal"},
+	},
+	{
+		friendlyName:  "Gnome Terminal (dconf)",
+		flagName:      "gnome-terminal",
+		output:        printGnomeDConf,
+		extensions:    []string{".sh"},
+		specialColors: []string{"background opacity"},
+	},
+	{
+		friendlyName:  "Kitty Terminal",
+		flagName:      "kitty",
+		output:        printKittyTerm,
+		input:         inputKittyTerm,
+		merge:         mergeKittyTerm,
+		extensions:    []string{".conf"},
+		configPaths:   []string{"~/.config/kitty/kitty.conf"},
+		specialColors: []string{"background opacity"},
+	},
+	{
+		friendlyName:  "Running terminal (OSC escape sequences)",
+		flagName:      "osc",
+		output:        printOSC,
+		specialColors: []string{"background", "foreground", "cursor", "selection"},
 	},
 	{
-		friendlyName: "Gnome Terminal (dconf)",
-		flagName:     "gnome-terminal",
-		output:       printGnomeDConf,
+		friendlyName: "Terminal preview (24-bit color)",
+		flagName:     "preview",
+		output:       printPreview,
 	},
 	{
-		friendlyName: "Kitty Terminal",
-		flagName:     "kitty",
-		output:       printKittyTerm,
-		input:        inputKittyTerm,
+		friendlyName:  "Running terminal (OSC queries)",
+		flagName:      "live",
+		input:         inputLive,
+		specialColors: []string{"background", "foreground"},
 	},
 }
+
+// findFormat returns the format with the given flag name
+func findFormat(name string) (Format, bool) {
+	for _, f := range formats {
+		if f.flagName == name {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// isImageFormat reports whether name is a format that generates an image
+func isImageFormat(name string) bool {
+	f, ok := findFormat(name)
+	return ok && f.render != nil
+}
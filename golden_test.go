@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"image/color"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden files with the current output of every format, instead of checking it")
+
+// Directory of the expected output of each format. Tests run in the
+// package directory, so this is relative to it.
+var goldenDir = filepath.Join("testdata", "golden")
+
+// The scheme every golden file is written from: xterm's default colors
+var goldenScheme = []color.Color{
+	color.NRGBA{0x00, 0x00, 0x00, 0xff}, color.NRGBA{0xcd, 0x00, 0x00, 0xff},
+	color.NRGBA{0x00, 0xcd, 0x00, 0xff}, color.NRGBA{0xcd, 0xcd, 0x00, 0xff},
+	color.NRGBA{0x00, 0x00, 0xee, 0xff}, color.NRGBA{0xcd, 0x00, 0xcd, 0xff},
+	color.NRGBA{0x00, 0xcd, 0xcd, 0xff}, color.NRGBA{0xe5, 0xe5, 0xe5, 0xff},
+	color.NRGBA{0x7f, 0x7f, 0x7f, 0xff}, color.NRGBA{0xff, 0x00, 0x00, 0xff},
+	color.NRGBA{0x00, 0xff, 0x00, 0xff}, color.NRGBA{0xff, 0xff, 0x00, 0xff},
+	color.NRGBA{0x5c, 0x5c, 0xff, 0xff}, color.NRGBA{0xff, 0x00, 0xff, 0xff},
+	color.NRGBA{0x00, 0xff, 0xff, 0xff}, color.NRGBA{0xff, 0xff, 0xff, 0xff},
+}
+
+// goldenTranslucent is goldenScheme with a translucent background given with
+// 16 bits per channel, for the precision and transparency settings of formats
+var goldenTranslucent = append([]color.Color{color.NRGBA64{0x1234, 0x5678, 0x9abc, 0xd999}}, goldenScheme[1:]...)
+
+// The schemes written for each format, by the suffix of their golden files
+var goldenSchemes = []struct {
+	suffix string
+	colors []color.Color
+}{
+	{"", goldenScheme},
+	{"-translucent", goldenTranslucent},
+}
+
+// checkXML checks that text is well formed XML
+func checkXML(text string) error {
+	decoder := xml.NewDecoder(strings.NewReader(text))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// A plistDict is the top level dictionary of a property list, as a list of
+// keys, each followed by its value
+type plistDict struct {
+	Entries []struct {
+		XMLName xml.Name
+		Content string `xml:",innerxml"`
+	} `xml:",any"`
+}
+
+type plist struct {
+	XMLName xml.Name  `xml:"plist"`
+	Dict    plistDict `xml:"dict"`
+}
+
+// plistValues parses a property list, returning the values of its top level
+// dictionary by key
+func plistValues(text string) (map[string]string, error) {
+	err := checkXML(text)
+	if err != nil {
+		return nil, err
+	}
+	var p plist
+	err = xml.Unmarshal([]byte(text), &p)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	for i := 0; i+1 < len(p.Dict.Entries); i += 2 {
+		if p.Dict.Entries[i].XMLName.Local != "key" {
+			return nil, errors.New("Expected a key in the plist dictionary, found <" + p.Dict.Entries[i].XMLName.Local + ">")
+		}
+		values[p.Dict.Entries[i].Content] = p.Dict.Entries[i+1].Content
+	}
+	return values, nil
+}
+
+func validateITerm2(text string) error {
+	values, err := plistValues(text)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < 16; i++ {
+		key := "Ansi " + strconv.Itoa(i) + " Color"
+		if _, ok := values[key]; !ok {
+			return errors.New("Missing " + key)
+		}
+	}
+	return nil
+}
+
+func validateOSXTerminal(text string) error {
+	values, err := plistValues(text)
+	if err != nil {
+		return err
+	}
+	for _, prefix := range []string{"ANSI", "ANSIBright"} {
+		for _, name := range slotNames {
+			key := prefix + strings.Title(name) + "Color"
+			data, ok := values[key]
+			if !ok {
+				return errors.New("Missing " + key)
+			}
+			// Each color is itself a base64 encoded plist
+			decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+			if err != nil {
+				return errors.New(key + ": " + err.Error())
+			}
+			err = checkXML(string(decoded))
+			if err != nil {
+				return errors.New(key + ": " + err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+func validateChrome(text string) error {
+	var colors map[string]string
+	err := json.Unmarshal([]byte(text), &colors)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < 16; i++ {
+		c, ok := colors[strconv.Itoa(i)]
+		if !ok {
+			return errors.New("Missing color " + strconv.Itoa(i))
+		}
+		_, err = parseColor(c)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validatePNG(text string) error {
+	_, err := png.Decode(strings.NewReader(text))
+	return err
+}
+
+// Checks of the output of formats that have a standard syntax, by parsing
+// it with a real parser
+var outputValidators = map[string]func(text string) error{
+	"iterm2":      validateITerm2,
+	"osxterminal": validateOSXTerminal,
+	"chrome":      validateChrome,
+	"img-swatch":  validatePNG,
+}
+
+// TestGolden compares the output of every format with its golden file, and
+// validates the output of formats with a standard syntax. With -update, the
+// golden files are rewritten instead.
+func TestGolden(t *testing.T) {
+	// The output of escape sequences mustn't depend on the terminal this runs in
+	savedPassthrough := *oscPassthrough
+	*oscPassthrough = "none"
+	t.Cleanup(func() {
+		*oscPassthrough = savedPassthrough
+	})
+
+	for _, f := range formats {
+		if f.output == nil {
+			continue
+		}
+		for _, scheme := range goldenSchemes {
+			f, scheme := f, scheme
+			t.Run(f.flagName+scheme.suffix, func(t *testing.T) {
+				checkGoldenFile(t, f, scheme.colors, f.flagName+scheme.suffix)
+			})
+		}
+	}
+}
+
+// checkGoldenFile writes a scheme in a format and compares it with the golden
+// file of that name, or with -update rewrites the golden file.
+func checkGoldenFile(t *testing.T, f Format, colors []color.Color, name string) {
+	output := f.output(colors)
+	if validate, ok := outputValidators[f.flagName]; ok {
+		err := validate(output)
+		if err != nil {
+			t.Error("Invalid output: " + err.Error())
+		}
+	}
+	// Images are checked by validating them, as compressing them may
+	// not give the same bytes in every Go version
+	if isBinary(output) {
+		return
+	}
+
+	filename := filepath.Join(goldenDir, name+".golden")
+	if *update {
+		err := os.MkdirAll(goldenDir, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filename, []byte(output), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	expected, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, []byte(output)) {
+		t.Errorf("Output differs from %v. If the change is intended, rewrite the golden files with 'go test -run TestGolden -update'\n%v", filename, unifiedDiff(filename, string(expected), output))
+	}
+}
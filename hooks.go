@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image/color"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A hookList holds the post_hook command for each output format, given with
+// -postHook FORMAT=COMMAND, which can be repeated.
+type hookList map[string]string
+
+func (h hookList) String() string {
+	return strings.Join(h.list(), ", ")
+}
+
+// list returns each hook as FORMAT=COMMAND, sorted by format
+func (h hookList) list() []string {
+	hooks := make([]string, 0, len(h))
+	for format, command := range h {
+		hooks = append(hooks, format+"="+command)
+	}
+	sort.Strings(hooks)
+	return hooks
+}
+
+func (h hookList) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) < 2 || parts[0] == "" {
+		return errors.New("Hooks must be given as FORMAT=COMMAND, Eg. 'xterm=xrdb -merge {path}'")
+	}
+	h[parts[0]] = parts[1]
+	return nil
+}
+
+// shellQuote quotes s as a single argument for sh
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// expandHook fills in the variables of a post_hook command:
+//
+//	{path}                     File the output was written to
+//	{format} {ext}             Output format, and its file extension
+//	{color0} ... {color15}     Colors of the scheme, as #rrggbb
+//	{background} {foreground}  Special colors of the scheme
+//
+// Paths and colors are quoted for the shell, since a # would start a comment.
+func expandHook(command string, t outputTarget, colors []color.Color) string {
+	replacements := []string{
+		"{path}", shellQuote(t.filename),
+		"{format}", t.format,
+		"{ext}", formatExtension(t.format),
+		"{background}", shellQuote(svgColor(colors[backgroundSlot])),
+		"{foreground}", shellQuote(svgColor(colors[foregroundSlot])),
+	}
+	for i, c := range colors {
+		replacements = append(replacements, "{color"+strconv.Itoa(i)+"}", shellQuote(svgColor(c)))
+	}
+	return strings.NewReplacer(replacements...).Replace(command)
+}
+
+// runHook runs a post_hook command with sh, stopping it after the -hookTimeout
+func runHook(command string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), *hookTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return errors.New("timed out after " + hookTimeout.String())
+	}
+	return err
+}
+
+// runHooks runs the post_hook of each output, and prints a summary of the
+// outputs written and how each hook went.
+func runHooks(colors []color.Color, targets []outputTarget) error {
+	results := make([]string, len(targets))
+	failed := 0
+	for i, t := range targets {
+		if t.hook == "" {
+			results[i] = "no hook"
+			continue
+		}
+		err := runHook(expandHook(t.hook, t, colors))
+		if err != nil {
+			results[i] = "hook failed: " + err.Error()
+			failed++
+		} else {
+			results[i] = "hook ok"
+		}
+	}
+
+	fmt.Fprint(os.Stderr, hookSummary(targets, results))
+	if failed > 0 {
+		return errors.New(strconv.Itoa(failed) + " of the post hooks failed")
+	}
+	return nil
+}
+
+// hookSummary lists each output written, and how its hook went
+func hookSummary(targets []outputTarget, results []string) string {
+	summary := "Summary:\n"
+	for i, t := range targets {
+		filename := t.filename
+		if filename == "" {
+			filename = "(stdout)"
+		}
+		summary += fmt.Sprintf("    %-14v %v  %v\n", t.format, filename, results[i])
+	}
+	return summary
+}
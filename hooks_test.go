@@ -0,0 +1,108 @@
+package main
+
+import (
+	"image/color"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpandHook(t *testing.T) {
+	colors := make([]color.Color, 16)
+	for i := range colors {
+		colors[i] = color.NRGBA{uint8(i), 0, 0, 255}
+	}
+	target := outputTarget{format: "kitty", filename: "/home/me/it's.conf"}
+	for _, test := range []struct {
+		command  string
+		expected string
+	}{
+		{"kitty @ set-colors {path}", `kitty @ set-colors '/home/me/it'\''s.conf'`},
+		{"cp {path} theme.{ext} # {format}", `cp '/home/me/it'\''s.conf' theme.conf # kitty`},
+		{"echo {color1} {color10} {color15}", "echo '#010000' '#0a0000' '#0f0000'"},
+		{"echo {background} {foreground}", "echo '#000000' '#070000'"},
+		{"echo {color16} {unknown}", "echo {color16} {unknown}"},
+	} {
+		if got := expandHook(test.command, target, colors); got != test.expected {
+			t.Errorf("expandHook(%q) = %q, expected %q", test.command, got, test.expected)
+		}
+	}
+}
+
+func TestRunHookTimeout(t *testing.T) {
+	registerDefaults()
+	saved := *hookTimeout
+	*hookTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { *hookTimeout = saved })
+
+	start := time.Now()
+	// exec, so that killing sh stops the sleep too
+	err := runHook("exec sleep 5")
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected the hook to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Hook was stopped after %v", elapsed)
+	}
+	if err := runHook("true"); err != nil {
+		t.Error(err)
+	}
+	if err := runHook("exit 3"); err == nil {
+		t.Error("Expected an error from a failing hook")
+	}
+}
+
+func TestHookSummary(t *testing.T) {
+	targets := []outputTarget{
+		{format: "kitty", filename: "kitty.conf", hook: "true"},
+		{format: "xterm"},
+		{format: "img", filename: "wallpaper.png", hook: "false"},
+	}
+	summary := hookSummary(targets, []string{"hook ok", "no hook", "hook failed: exit status 1"})
+	expected := "Summary:\n" +
+		"    kitty          kitty.conf  hook ok\n" +
+		"    xterm          (stdout)  no hook\n" +
+		"    img            wallpaper.png  hook failed: exit status 1\n"
+	if summary != expected {
+		t.Errorf("Summary is\n%v\nexpected\n%v", summary, expected)
+	}
+
+	colors := make([]color.Color, 16)
+	err := runHooks(colors, targets)
+	if err == nil || err.Error() != "1 of the post hooks failed" {
+		t.Errorf("Expected one hook to fail, got %v", err)
+	}
+}
+
+// TestImageHookPath checks that the hook of image output written to the
+// default file is given that file.
+func TestImageHookPath(t *testing.T) {
+	registerDefaults()
+	dir := t.TempDir()
+	savedFile, savedWidth, savedHeight := defaultImageFile, *imageWidth, *imageHeight
+	defaultImageFile = filepath.Join(dir, "schemer_out.png")
+	*imageWidth, *imageHeight = 100, 100
+	t.Cleanup(func() {
+		defaultImageFile, *imageWidth, *imageHeight = savedFile, savedWidth, savedHeight
+	})
+
+	hookOutput := filepath.Join(dir, "hook")
+	targets := []outputTarget{{format: "img", hook: "echo {path} > " + shellQuote(hookOutput)}}
+	colors := make([]color.Color, 16)
+	for i := range colors {
+		colors[i] = color.NRGBA{uint8(i * 16), 0, 0, 255}
+	}
+	err := writeOutputs(colors, targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(hookOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(got)) != defaultImageFile {
+		t.Errorf("Hook was given %q, expected %v", got, defaultImageFile)
+	}
+}
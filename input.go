@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/hex"
 	"errors"
 	"image/color"
 	"io/ioutil"
@@ -21,27 +20,14 @@ func readFile(filename string) (string, error) {
 	return config, nil
 }
 
-func parseColor(c string) (color.Color, error) {
-	// Takes in a string of the format #FFFFFF or #FFFFFFFFFFFF and returns a color
-	// Remove leading #
-	c = strings.TrimPrefix(c, "#")
-	// Convert hexadecimal string to array of bytes.
-	bytes, err := hex.DecodeString(c)
-	if err != nil {
-		return nil, err
+// trimKeyValue removes the spaces around a "key=value" config line and its
+// '=', leaving any spaces inside the value, Eg. in "rgb(0, 0, 0)".
+func trimKeyValue(line string) string {
+	line = strings.TrimSpace(line)
+	if i := strings.Index(line, "="); i >= 0 {
+		return strings.TrimSpace(line[:i]) + "=" + strings.TrimSpace(line[i+1:])
 	}
-
-	// Covert to array of uint8s
-	uints := []uint8(bytes[:])
-
-	// Take 0,1,2 indexes for a 6 character string, and 0,2,4 indexes for 12 characters
-	if len(uints) == 6 {
-		return color.NRGBA{uints[0], uints[2], uints[4], 255}, nil
-	} else if len(uints) == 3 {
-		return color.NRGBA{uints[0], uints[1], uints[2], 255}, nil
-	}
-
-	return nil, errors.New("Could not parse color: " + c)
+	return line
 }
 
 func inputXfce(filename string) ([]color.Color, error) {
@@ -54,9 +40,9 @@ func inputXfce(filename string) ([]color.Color, error) {
 	// Split into lines
 	lines := strings.Split(config, "\n")
 
-	// Remove all spaces
+	// Remove spaces around keys and values
 	for i, l := range lines {
-		lines[i] = strings.Replace(l, " ", "", -1)
+		lines[i] = trimKeyValue(l)
 	}
 
 	// Find line containing color palette
@@ -87,6 +73,22 @@ func inputXfce(filename string) ([]color.Color, error) {
 		colors = append(colors, col)
 	}
 
+	// A transparent background's darkness is its opacity
+	transparent, darkness := false, ""
+	for _, l := range lines {
+		transparent = transparent || l == "BackgroundMode=TERMINAL_BACKGROUND_TRANSPARENT"
+		if strings.HasPrefix(l, "BackgroundDarkness=") {
+			darkness = strings.TrimPrefix(l, "BackgroundDarkness=")
+		}
+	}
+	if transparent && darkness != "" && len(colors) > backgroundSlot {
+		alpha, err := strconv.ParseFloat(darkness, 64)
+		if err != nil {
+			return nil, errors.New("Could not parse BackgroundDarkness: " + darkness)
+		}
+		colors[backgroundSlot] = withOpacity(colors[backgroundSlot], alpha)
+	}
+
 	return colors, nil
 }
 
@@ -102,13 +104,12 @@ func inputLilyTerm(filename string) ([]color.Color, error) {
 	// Split into lines
 	lines := strings.Split(config, "\n")
 
-	// Remove all spaces
+	// Remove spaces around keys and values
 	for i, l := range lines {
-		lines[i] = strings.Replace(l, " ", "", -1)
+		lines[i] = trimKeyValue(l)
 	}
 
 	// For all 16 colors (Color1, Color2...), search for each.
-	// TODO: Support for 16 bit, and "black"
 	for i := 0; i < 16; i++ {
 		for _, l := range lines {
 			prefix := "Color"
@@ -144,9 +145,9 @@ func inputTermite(filename string) ([]color.Color, error) {
 	// Split into lines
 	lines := strings.Split(config, "\n")
 
-	// Remove all spaces
+	// Remove spaces around keys and values
 	for i, l := range lines {
-		lines[i] = strings.Replace(l, " ", "", -1)
+		lines[i] = trimKeyValue(l)
 	}
 
 	// For all 16 colors (Color1, Color2...), search for each.
@@ -169,6 +170,17 @@ func inputTermite(filename string) ([]color.Color, error) {
 		}
 	}
 
+	// The background's alpha, Eg. "background = rgba(0, 0, 0, 0.8)"
+	for _, l := range lines {
+		if strings.HasPrefix(l, "background=") && len(colors) > backgroundSlot {
+			col, err := parseColor(strings.TrimPrefix(l, "background="))
+			if err != nil {
+				return nil, err
+			}
+			colors[backgroundSlot] = withOpacity(colors[backgroundSlot], opacity(col))
+		}
+	}
+
 	return colors, nil
 }
 
@@ -182,9 +194,9 @@ func inputTerminator(filename string) ([]color.Color, error) {
 	// Split into lines
 	lines := strings.Split(config, "\n")
 
-	// Remove all spaces
+	// Remove spaces around keys and values
 	for i, l := range lines {
-		lines[i] = strings.Replace(l, " ", "", -1)
+		lines[i] = trimKeyValue(l)
 	}
 
 	// Find line containing color palette
@@ -217,7 +229,7 @@ func inputTerminator(filename string) ([]color.Color, error) {
 
 }
 
-func inputXterm(filename string) ([]color.Color, error) {
+func inputKittyTerm(filename string) ([]color.Color, error) {
 	// Read in file
 	config, err := readFile(filename)
 	if err != nil {
@@ -227,74 +239,51 @@ func inputXterm(filename string) ([]color.Color, error) {
 	// Split into lines
 	lines := strings.Split(config, "\n")
 
-	// Remove all spaces
-	for i, l := range lines {
-		lines[i] = strings.Replace(l, " ", "", -1)
+	// Search for lines setting a color, Eg. "color1 #ff0000"
+	re := regexp.MustCompile(`^\s*color([0-9]+)\s+(.*\S)`)
+	type colorLine struct {
+		number int
+		value  string
 	}
-
-	colorlines := make([]string, 0)
-	// Search for lines containing color information
-	re := regexp.MustCompile("[\\*]?[URXvurxterm]*[\\*.]+color[0-9]*")
+	opacityLine := regexp.MustCompile(`^\s*background_opacity\s+(\S+)`)
+	opacitySetting := ""
+	colorlines := make([]colorLine, 0)
 	for _, l := range lines {
-		if len(re.FindAllString(l, 1)) != 0 {
-			colorlines = append(colorlines, l)
+		if m := opacityLine.FindStringSubmatch(l); m != nil {
+			opacitySetting = m[1]
 		}
-	}
-
-	// Extract and parse colors
-	// TODO: Sort by number first?
-	colors := make([]color.Color, 0)
-	for _, l := range colorlines {
-		// Assuming the color to be the rightmost half of the last colon
-		splits := strings.Split(l, ":")
-		colorstring := splits[len(splits)-1]
-		col, err := parseColor(colorstring)
-		if err != nil {
-			return nil, err
+		m := re.FindStringSubmatch(l)
+		if m == nil {
+			continue
 		}
-		colors = append(colors, col)
-	}
-
-	return colors, nil
-}
-
-func inputKittyTerm(filename string) ([]color.Color, error) {
-	// Read in file
-	config, err := readFile(filename)
-	if err != nil {
-		return nil, err
-	}
-
-	// Split into lines
-	lines := strings.Split(config, "\n")
-
-	colorlines := make([]string, 0)
-	// Search for lines containing color information
-	re := regexp.MustCompile("^color[0-9]*")
-	for _, l := range lines {
-		if len(re.FindAllString(l, 1)) != 0 {
-			colorlines = append(colorlines, strings.Replace(l, "color", "", 1))
+		number, err := strconv.Atoi(m[1])
+		if err != nil {
+			continue
 		}
+		colorlines = append(colorlines, colorLine{number, m[2]})
 	}
 
-	sort.Slice(colorlines, func(i, j int) bool {
-		numA, _ := strconv.Atoi(strings.TrimSpace(colorlines[i][:2]))
-		numB, _ := strconv.Atoi(strings.TrimSpace(colorlines[j][:2]))
-		return numA < numB
+	sort.SliceStable(colorlines, func(i, j int) bool {
+		return colorlines[i].number < colorlines[j].number
 	})
 
 	// Extract and parse colors
 	colors := make([]color.Color, 0)
 	for _, l := range colorlines {
-		// Assuming the color to be the rightmost half of the last instance of space/tab
-		splits := strings.Fields(l)
-		colorstring := splits[len(splits)-1]
-		col, err := parseColor(colorstring)
+		col, err := parseColor(l.value)
 		if err != nil {
 			return nil, err
 		}
 		colors = append(colors, col)
 	}
 
+	if opacitySetting != "" && len(colors) > backgroundSlot {
+		alpha, err := strconv.ParseFloat(opacitySetting, 64)
+		if err != nil {
+			return nil, errors.New("Could not parse background_opacity: " + opacitySetting)
+		}
+		colors[backgroundSlot] = withOpacity(colors[backgroundSlot], alpha)
+	}
+
 	return colors, nil
 }
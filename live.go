@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Replies to OSC 4, 10 and 11 color queries.
+// Eg, "\033]4;1;rgb:cdcd/0000/0000\033\\"
+var oscReply = regexp.MustCompile("\033\\]((?:4;[0-9]+)|10|11);rgb:([0-9a-fA-F]{1,4})/([0-9a-fA-F]{1,4})/([0-9a-fA-F]{1,4})(?:\033\\\\|\a)")
+
+// inputLive reads the palette of the terminal on filename (default /dev/tty),
+// by asking it for its colors with OSC queries.
+// With -liveBackground, the terminal's background and foreground colors
+// replace color 0 and color 7, the palette slots the osc output sets them from.
+func inputLive(filename string) ([]color.Color, error) {
+	if filename == "" {
+		filename = "/dev/tty"
+	}
+	tty, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer tty.Close()
+
+	restore, err := makeRaw(tty)
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
+
+	queries := ""
+	for i := 0; i < 16; i++ {
+		queries += "\033]4;" + strconv.Itoa(i) + ";?\033\\"
+	}
+	expected := 16
+	if *liveBackground {
+		queries += "\033]10;?\033\\\033]11;?\033\\"
+		expected += 2
+	}
+	_, err = fmt.Fprint(tty, queries)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read replies until there is one for every query, or the terminal stops answering
+	replies := make(map[string]color.Color)
+	received := ""
+	buf := make([]byte, 1024)
+	deadline := time.Now().Add(*liveTimeout)
+	for len(replies) < expected && time.Now().Before(deadline) {
+		// Reads return nothing (EOF) when no reply arrives in time
+		n, err := tty.Read(buf)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		received += string(buf[:n])
+		for _, m := range oscReply.FindAllStringSubmatch(received, -1) {
+			var channels [3]uint16
+			for i := range channels {
+				channels[i], err = scaleHex(m[i+2])
+				if err != nil {
+					return nil, err
+				}
+			}
+			replies[m[1]] = color.NRGBA64{channels[0], channels[1], channels[2], 0xffff}
+		}
+	}
+
+	colors := make([]color.Color, 0, 16)
+	for i := 0; i < 16; i++ {
+		c, ok := replies["4;"+strconv.Itoa(i)]
+		if !ok {
+			break
+		}
+		colors = append(colors, c)
+	}
+	if len(colors) == 0 {
+		return nil, errors.New("Terminal did not reply to color queries. It may not support them.")
+	}
+	if !*liveBackground {
+		return colors, nil
+	}
+	if bg, ok := replies["11"]; ok && len(colors) > backgroundSlot {
+		colors[backgroundSlot] = bg
+	}
+	if fg, ok := replies["10"]; ok && len(colors) > foregroundSlot {
+		colors[foregroundSlot] = fg
+	}
+	return colors, nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"os"
+	"regexp"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// openPTY opens a pseudo-terminal, returning its master side and the path
+// of its slave side, which inputLive opens as the terminal.
+func openPTY(t *testing.T) (*os.File, string) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skip("No pseudo-terminals available: ", err)
+	}
+	t.Cleanup(func() { master.Close() })
+
+	unlock := 0
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock)))
+	if errno != 0 {
+		t.Fatal("Unlocking pseudo-terminal: ", errno)
+	}
+	var n uint32
+	_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n)))
+	if errno != 0 {
+		t.Fatal("Finding pseudo-terminal: ", errno)
+	}
+	return master, "/dev/pts/" + strconv.Itoa(int(n))
+}
+
+// The colors of the fake terminal
+var (
+	fakePalette    [16]color.NRGBA64
+	fakeForeground = color.NRGBA64{0xeeee, 0xdddd, 0xcccc, 0xffff}
+	fakeBackground = color.NRGBA64{0x1111, 0x2222, 0x3333, 0xffff}
+)
+
+func init() {
+	for i := range fakePalette {
+		fakePalette[i] = color.NRGBA64{uint16(i) * 0x1111, 0x1234, 0xfedc, 0xffff}
+	}
+}
+
+var oscQuery = regexp.MustCompile("\033\\]((?:4;([0-9]+))|10|11);\\?\033\\\\")
+
+// fakeTerminal answers the color queries written to a pseudo-terminal, as a
+// terminal emulator would, until the master side is closed. Odd palette
+// entries are answered with BEL rather than ST, as some terminals do.
+func fakeTerminal(master *os.File) {
+	buf := make([]byte, 1024)
+	received := ""
+	for {
+		n, err := master.Read(buf)
+		if err != nil {
+			return
+		}
+		received += string(buf[:n])
+		for _, m := range oscQuery.FindAllStringSubmatch(received, -1) {
+			c, terminator := fakeForeground, "\033\\"
+			switch {
+			case m[1] == "11":
+				c = fakeBackground
+			case m[2] != "":
+				i, _ := strconv.Atoi(m[2])
+				c = fakePalette[i]
+				if i%2 == 1 {
+					terminator = "\a"
+				}
+			}
+			fmt.Fprintf(master, "\033]%v;rgb:%04x/%04x/%04x%v", m[1], c.R, c.G, c.B, terminator)
+		}
+		received = oscQuery.ReplaceAllString(received, "")
+	}
+}
+
+// setLiveOptions sets the live input options for a test
+func setLiveOptions(t *testing.T, timeout time.Duration, background bool) {
+	savedTimeout, savedBackground := *liveTimeout, *liveBackground
+	*liveTimeout, *liveBackground = timeout, background
+	t.Cleanup(func() {
+		*liveTimeout, *liveBackground = savedTimeout, savedBackground
+	})
+}
+
+func TestInputLive(t *testing.T) {
+	for _, background := range []bool{false, true} {
+		t.Run(fmt.Sprintf("liveBackground=%v", background), func(t *testing.T) {
+			setLiveOptions(t, 2*time.Second, background)
+			master, slave := openPTY(t)
+			go fakeTerminal(master)
+
+			colors, err := inputLive(slave)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(colors) != 16 {
+				t.Fatalf("Read %d colors, expected 16", len(colors))
+			}
+			for i, c := range colors {
+				expected := fakePalette[i]
+				if background && i == backgroundSlot {
+					expected = fakeBackground
+				} else if background && i == foregroundSlot {
+					expected = fakeForeground
+				}
+				if nrgba64(c) != expected {
+					t.Errorf("color%d is %v, expected %v", i, c, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestInputLiveNoReply(t *testing.T) {
+	setLiveOptions(t, 300*time.Millisecond, false)
+	master, slave := openPTY(t)
+	// A terminal that reads the queries but never answers them
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			if _, err := master.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	_, err := inputLive(slave)
+	if err == nil {
+		t.Fatal("Expected an error when the terminal doesn't reply")
+	}
+}
+
+func TestMakeRawRestores(t *testing.T) {
+	_, slave := openPTY(t)
+	tty, err := os.OpenFile(slave, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tty.Close()
+
+	termios := func() syscall.Termios {
+		var state syscall.Termios
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, tty.Fd(), syscall.TCGETS, uintptr(unsafe.Pointer(&state)))
+		if errno != 0 {
+			t.Fatal(errno)
+		}
+		return state
+	}
+	before := termios()
+	restore, err := makeRaw(tty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := termios()
+	if raw.Lflag&(syscall.ECHO|syscall.ICANON) != 0 {
+		t.Error("Terminal still echoes or reads whole lines in raw mode")
+	}
+	restore()
+	if termios() != before {
+		t.Error("Terminal mode was not restored")
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+func makeRaw(tty *os.File) (func(), error) {
+	return nil, errors.New("Reading colors from a running terminal is only supported on Linux")
+}
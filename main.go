@@ -1,13 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"flag"
 	"fmt"
+	"image"
 	"image/color"
 	"image/png"
-	"log"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
 const (
@@ -15,53 +19,266 @@ const (
 )
 
 var (
-	outfile       *string
-	infile        *string
-	format_string *string
+	outfile       = new(string)
+	infile        = new(string)
+	format_string = new(string)
+	manifestFile  = new(string)
 
 	// Image input options
-	threshold     *int
-	minBrightness *int
-	maxBrightness *int
+	threshold     = new(int)
+	minBrightness = new(int)
+	maxBrightness = new(int)
 
 	// Generic image output options
-	imageWidth   *int
-	imageHeight  *int
-	imageOutType *string // Eg, "random", "circles", "stripes", etc...
-	imageOverlay *string
+	imageWidth   = new(int)
+	imageHeight  = new(int)
+	imageOutType = new(string) // Eg, "random", "circles", "stripes", etc...
+	imageOverlay = new(string)
+	antialias    = new(int)
+	imageSeed    = new(int64)
+
+	// Overlay image options
+	overlayGravity = new(string)
+	overlayMargin  = new(int)
+	overlayScale   = new(int)
+	overlayOpacity = new(int)
+	overlayColor   = new(int)
+
+	// Multiple monitor options
+	monitors      = new(string)
+	monitorsSplit = new(bool)
 
 	// Circles image output options
-	circlesSize                  *int
-	circlesSizeVariance          *int
-	circlesOverlap               *bool
-	circlesDrawLargestToSmallest *bool
-	circlesFilled                *bool
-	circlesBorderSize            *int
-	circlesBlur                  *bool
-	circlesOpacity               *int
+	circlesSize                  = new(int)
+	circlesSizeVariance          = new(int)
+	circlesOverlap               = new(bool)
+	circlesDrawLargestToSmallest = new(bool)
+	circlesFilled                = new(bool)
+	circlesBorderSize            = new(int)
+	circlesBlur                  = new(bool)
+	circlesOpacity               = new(int)
 
 	// Ray image output options
-	raysSize                  *int
-	raysSizeVariance          *int
-	raysDistributeEvenly      *bool
-	raysCentered              *bool
-	raysDrawLargestToSmallest *bool
+	raysSize                  = new(int)
+	raysSizeVariance          = new(int)
+	raysDistributeEvenly      = new(bool)
+	raysCentered              = new(bool)
+	raysDrawLargestToSmallest = new(bool)
 
 	// Stripes image output options
-	stripesSize         *int
-	stripesSizeVariance *int
-	stripesHorizontal   *bool
-	stripesEqualSize    *bool
-	stripesEvenSpacing  *bool
-	stripesSpacing      *int
-	stripesOffset       *int
+	stripesSize         = new(int)
+	stripesSizeVariance = new(int)
+	stripesHorizontal   = new(bool)
+	stripesEqualSize    = new(bool)
+	stripesEvenSpacing  = new(bool)
+	stripesSpacing      = new(int)
+	stripesOffset       = new(int)
+
+	// OSC output options
+	oscPassthrough = new(string)
+	oscAllTTYs     = new(bool)
+
+	// Live input options
+	liveTimeout    = new(time.Duration)
+	liveBackground = new(bool)
+
+	// Config file output options
+	merge        = new(bool)
+	mergeProfile = new(string)
+	backup       = new(bool)
+	backupCount  = new(int)
+	showDiff     = new(bool)
+
+	// Config file options
+	preset = new(string)
+
+	// Watch options
+	watch      = new(bool)
+	watchDelay = new(time.Duration)
+
+	// Post hook options
+	postHooks   = make(hookList)
+	hookTimeout = new(time.Duration)
 
 	// Show advanced help
-	advancedoptions *bool
+	advancedoptions = new(bool)
 )
 
+// A flagGroup is a set of related command line options.
+// Each subcommand only has the groups of options that apply to it.
+type flagGroup struct {
+	name     string
+	register func(fs *flag.FlagSet)
+}
+
+// isOption reports whether value is one of options
+func isOption(value string, options []string) bool {
+	for _, o := range options {
+		if value == o {
+			return true
+		}
+	}
+	return false
+}
+
+// optionsList formats a list of choices for a flag's description
+func optionsList(description string, options []string) string {
+	description += " Available options: \n"
+	for _, o := range options {
+		description += "    "
+		description += o
+		description += "\n"
+	}
+	return description
+}
+
+var ioFlags = flagGroup{"Input and output", func(fs *flag.FlagSet) {
+	fs.StringVar(infile, "in", "", "Input file")
+	fs.StringVar(outfile, "out", "", "File to write output to. With several output formats, {format} and {ext} are replaced with each format's name and file extension, Eg. 'theme.{ext}'")
+	fs.StringVar(manifestFile, "manifest", "", "File listing more outputs to write, one 'format = \"file\"' per line")
+}}
+
+var hookFlags = flagGroup{"Post hook", func(fs *flag.FlagSet) {
+	fs.Var(postHooks, "postHook", "Command to run after writing an output, as FORMAT=COMMAND. Can be repeated. {path}, {format}, {ext}, {color0}-{color15}, {background} and {foreground} are filled in, Eg. 'xterm=xrdb -merge {path}'")
+	fs.DurationVar(hookTimeout, "hookTimeout", 10*time.Second, "How long to let each post hook run before stopping it")
+}}
+
+var presetFlags = flagGroup{"Preset", func(fs *flag.FlagSet) {
+	fs.StringVar(preset, "preset", "", "Use the options of a preset from the config file, Eg. 'bokeh'. Options given on the command line override it")
+}}
+
+var watchFlags = flagGroup{"Watch", func(fs *flag.FlagSet) {
+	fs.BoolVar(watch, "watch", false, "Keep running, and write the outputs again, running their post hooks, whenever the input file changes")
+	fs.DurationVar(watchDelay, "watchDelay", 250*time.Millisecond, "How long the input file must stop changing for before writing the outputs again")
+}}
+
+var imageInputFlags = flagGroup{"Image input", func(fs *flag.FlagSet) {
+	fs.IntVar(threshold, "threshold", 50, "Threshold for minimum color difference (image input only)")
+	fs.IntVar(minBrightness, "minBright", 0, "Minimum brightness for colors (image input only)")
+	fs.IntVar(maxBrightness, "maxBright", 200, "Maximum brightness for colors (image input only)")
+}}
+
+var liveInputFlags = flagGroup{"Live input", func(fs *flag.FlagSet) {
+	fs.DurationVar(liveTimeout, "liveTimeout", time.Second, "How long to wait for the terminal to reply to color queries (live input only)")
+	fs.BoolVar(liveBackground, "liveBackground", false, "Replace color 0 and color 7 with the terminal's background and foreground colors (live input only)")
+}}
+
+var fileOutputFlags = flagGroup{"Config file output", func(fs *flag.FlagSet) {
+	fs.BoolVar(merge, "merge", false, "Replace only the colors in an existing output file, keeping the rest of it")
+	fs.BoolVar(backup, "backup", true, "Back up files before replacing them. Restore backups with 'schemer2 restore'")
+	fs.IntVar(backupCount, "backupCount", 10, "Number of backups to keep of each file, deleting older ones. 0 keeps every backup")
+	fs.BoolVar(showDiff, "diff", false, "Show what would change in the output file, without writing it. Image output shows the image size and palette instead")
+	fs.StringVar(mergeProfile, "mergeProfile", "default", "Profile to replace the colors of when merging (Terminator only)")
+}}
+
+var oscOutputFlags = flagGroup{"OSC output", func(fs *flag.FlagSet) {
+	fs.StringVar(oscPassthrough, "oscPassthrough", "auto", optionsList("Wrap escape sequences to pass through a terminal multiplexer.", oscPassthroughModes[:]))
+	fs.BoolVar(oscAllTTYs, "oscAllTTYs", false, "Apply the colors to every terminal in /dev/pts, instead of writing the escape sequences to the output")
+}}
+
+var imageOutputFlags = flagGroup{"Image output", func(fs *flag.FlagSet) {
+	fs.IntVar(imageHeight, "height", 1080, "Height of output image")
+	fs.IntVar(imageWidth, "width", 1920, "Width of output image")
+	fs.StringVar(imageOutType, "imageOutType", "random", optionsList("Type of image to generate.", imageOutTypes[:]))
+	fs.StringVar(imageOverlay, "imageOverlay", "", "Filename of image to draw on top of generated image (OS/Distro logo, etc...)")
+	fs.Int64Var(imageSeed, "seed", 0, "Seed for laying out generated images. The same seed gives the same layout at any resolution. 0 picks a random seed")
+	fs.IntVar(antialias, "aa", 4, "Anti-aliasing supersampling factor for generated images, from 1 to 16. 1 disables anti-aliasing")
+}}
+
+var overlayFlags = flagGroup{"Overlay image", func(fs *flag.FlagSet) {
+	fs.StringVar(overlayGravity, "overlayGravity", "center", optionsList("Where to place the overlay image.", overlayGravities[:]))
+	fs.IntVar(overlayMargin, "overlayMargin", 0, "Distance in pixels between the overlay image and the edges of the image")
+	fs.IntVar(overlayScale, "overlayScale", 0, "Height of the overlay image as a percentage of the image height. 0 keeps its original size")
+	fs.IntVar(overlayOpacity, "overlayOpacity", 100, "Opacity of the overlay image, from 0 to 100")
+	fs.IntVar(overlayColor, "overlayColor", -1, "Recolor the overlay image with this palette color (0-15), keeping its transparency. -1 keeps its own colors")
+}}
+
+var monitorFlags = flagGroup{"Multiple monitors", func(fs *flag.FlagSet) {
+	fs.StringVar(monitors, "monitors", "", "Geometry of each monitor, to draw one image across them all. Eg. '2560x1440+0+0,1920x1080+2560+180'")
+	fs.BoolVar(monitorsSplit, "monitorsSplit", false, "Write a separate image for each monitor, numbered from 0, instead of one spanned image")
+}}
+
+var circlesFlags = flagGroup{"Circles image", func(fs *flag.FlagSet) {
+	fs.IntVar(circlesSize, "circlesSize", 100, "Size of circles in output image")
+	fs.IntVar(circlesSizeVariance, "circlesSizeVariance", 50, "Maximum variance in circle size")
+	fs.BoolVar(circlesOverlap, "circlesOverlap", true, "Allow circles to overlap !!! Unimplemented !!!")
+	fs.BoolVar(circlesDrawLargestToSmallest, "circlesLargeToSmall", true, "Order circles z-index by size (smaller circles are drawn in front of larger circles)")
+	fs.BoolVar(circlesFilled, "circlesFilled", false, "Fill circles")
+	fs.BoolVar(circlesBlur, "circlesBlurred", false, "Blur circles")
+	fs.IntVar(circlesOpacity, "circlesOpacity", 100, "Opacity of circles")
+	fs.IntVar(circlesBorderSize, "circlesBorderSize", 10, "Border of circles when unfilled")
+}}
+
+var raysFlags = flagGroup{"Rays image", func(fs *flag.FlagSet) {
+	fs.IntVar(raysSize, "raysSize", 16, "Size of rays in output image")
+	fs.IntVar(raysSizeVariance, "raysSizeVariance", 8, "Maximum variance in rays size")
+	fs.BoolVar(raysDistributeEvenly, "raysDistributeEvenly", false, "Distribute rays evenly")
+	fs.BoolVar(raysCentered, "raysCentered", true, "Center rays in middle")
+	fs.BoolVar(raysDrawLargestToSmallest, "raysLargeToSmall", false, "Order rays z-index by size (smaller rays are drawn on top of larger rays)")
+}}
+
+var stripesFlags = flagGroup{"Stripes image", func(fs *flag.FlagSet) {
+	fs.IntVar(stripesSize, "stripesSize", 6, "Size of stripes in output image")
+	fs.IntVar(stripesSizeVariance, "stripesSizeVariance", 3, "Maximum variance in stripes size")
+	fs.BoolVar(stripesHorizontal, "stripesHorizontal", false, "Draw stripes horizontally instead of vertically")
+	fs.BoolVar(stripesEvenSpacing, "stripesEvenSpacing", true, "Space all stripes evenly")
+	fs.IntVar(stripesSpacing, "stripesSpacing", 0, "Space stripes by this amount when spacing evenly")
+	fs.IntVar(stripesOffset, "stripesOffset", 0, "Offset stripes by this amount")
+}}
+
+// Every group of options, as used by the original -format form of the command line
+var flagGroups = []flagGroup{ioFlags, presetFlags, hookFlags, watchFlags, imageInputFlags, liveInputFlags, fileOutputFlags, oscOutputFlags, imageOutputFlags, overlayFlags, monitorFlags, circlesFlags, raysFlags, stripesFlags}
+
+// Names of the flags in each group, by group name
+var groupFlagNames = make(map[string][]string)
+
+// registerDefaults sets every option to its default value, so that options
+// which aren't part of a subcommand still have sensible values.
+func registerDefaults() {
+	groups := flagGroups
+	for _, c := range commands {
+		groups = append(groups, c.groups...)
+	}
+	for _, g := range groups {
+		if _, ok := groupFlagNames[g.name]; ok {
+			continue
+		}
+		fs := flag.NewFlagSet(g.name, flag.ContinueOnError)
+		g.register(fs)
+		fs.VisitAll(func(f *flag.Flag) {
+			groupFlagNames[g.name] = append(groupFlagNames[g.name], f.Name)
+		})
+	}
+}
+
+// printGroups prints the descriptions of the flags in fs, under the heading of each group
+func printGroups(fs *flag.FlagSet, groups []flagGroup) {
+	for _, g := range groups {
+		fmt.Println(g.name + " options:")
+		groupSet := flag.NewFlagSet(g.name, flag.ContinueOnError)
+		groupSet.SetOutput(os.Stdout)
+		for _, name := range groupFlagNames[g.name] {
+			f := fs.Lookup(name)
+			if f != nil {
+				groupSet.Var(f.Value, f.Name, f.Usage)
+				groupSet.Lookup(f.Name).DefValue = f.DefValue
+			}
+		}
+		groupSet.PrintDefaults()
+		fmt.Println()
+	}
+}
+
 func usage() {
-	fmt.Println("Usage: schemer2 [FLAGS] -format [INPUTFORMAT]" + format_separator + "[OUTPUTFORMAT] -in [INPUTFILE] -out [OUTPUTFILE]")
+	fmt.Println("Usage: schemer2 [COMMAND] [FLAGS]")
+	fmt.Println("       schemer2 [FLAGS] -format [INPUTFORMAT]" + format_separator + "[OUTPUTFORMAT] -in [INPUTFILE] -out [OUTPUTFILE]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	for _, c := range commands {
+		fmt.Printf("    %-10v %v\n", c.name, c.summary)
+	}
+	fmt.Println()
+	fmt.Println("Run 'schemer2 help [COMMAND]' for the options of a command.")
 }
 
 func flags_usage() {
@@ -73,7 +290,7 @@ func flags_usage() {
 	if !*advancedoptions {
 		fmt.Println("Run with -help-advanced flag to show advanced options")
 	} else {
-		flag.PrintDefaults()
+		printGroups(flag.CommandLine, flagGroups)
 	}
 }
 
@@ -81,7 +298,7 @@ func inputs_outputs() {
 	inSupport := "Input formats:\n"
 	outSupport := "Output formats:\n"
 	for _, f := range formats {
-		if f.output != nil {
+		if f.output != nil || f.render != nil {
 			outSupport += strings.Join([]string{"    ", f.friendlyName, ":", f.flagName, "\n"}, " ")
 		}
 
@@ -89,120 +306,121 @@ func inputs_outputs() {
 			inSupport += strings.Join([]string{"    ", f.friendlyName, ":", f.flagName, "\n"}, " ")
 		}
 	}
-	// Special case for img output
-	outSupport += "     Image output : img\n"
 
 	fmt.Print(inSupport, "\n", outSupport)
 }
 
-func main() {
-	infile = flag.String("in", "", "Input file")
-	outfile = flag.String("out", "", "File to write output to.")
-	format_string = flag.String("format", "", "Format of input and output. Eg. 'image"+format_separator+"xterm'")
+// Largest -aa factor. Only pixels on the edges of shapes are sampled this
+// many times over, but each of them is sampled maxAntialias² times.
+const maxAntialias = 16
 
-	threshold = flag.Int("threshold", 50, "Threshold for minimum color difference (image input only)")
-	minBrightness = flag.Int("minBright", 0, "Minimum brightness for colors (image input only)")
-	maxBrightness = flag.Int("maxBright", 200, "Maximum brightness for colors (image input only)")
-
-	imageHeight = flag.Int("height", 1080, "Height of output image")
-	imageWidth = flag.Int("width", 1920, "Width of output image")
-	imageOutTypeDesc := "Type of image to generate. Available options: \n"
-	for _, t := range imageOutTypes {
-		imageOutTypeDesc += "    "
-		imageOutTypeDesc += t
-		imageOutTypeDesc += "\n"
+// validateOptions checks the values of options that have limits
+func validateOptions() error {
+	if *minBrightness > 255 || *maxBrightness > 255 {
+		return errors.New("Minimum and maximum brightness must be an integer between 0 and 255.")
 	}
-	imageOutType = flag.String("imageOutType", "random", imageOutTypeDesc)
-	imageOverlay = flag.String("imageOverlay", "", "Filename of image to draw on top of generated image (OS/Distro logo, etc...)")
-
-	// Circles image output options
-	circlesSize = flag.Int("circlesSize", 100, "Size of circles in output image")
-	circlesSizeVariance = flag.Int("circlesSizeVariance", 50, "Maximum variance in circle size")
-	circlesOverlap = flag.Bool("circlesOverlap", true, "Allow circles to overlap !!! Unimplemented !!!")
-	circlesDrawLargestToSmallest = flag.Bool("circlesLargeToSmall", true, "Order circles z-index by size (smaller circles are drawn in front of larger circles)")
-	circlesFilled = flag.Bool("circlesFilled", false, "Fill circles")
-	circlesBlur = flag.Bool("circlesBlurred", false, "Blur circles")
-	circlesOpacity = flag.Int("circlesOpacity", 100, "Opacity of circles")
-	circlesBorderSize = flag.Int("circlesBorderSize", 10, "Border of circles when unfilled")
-
-	// Ray image output options
-	raysSize = flag.Int("raysSize", 16, "Size of rays in output image")
-	raysSizeVariance = flag.Int("raysSizeVariance", 8, "Maximum variance in rays size")
-	raysDistributeEvenly = flag.Bool("raysDistributeEvenly", false, "Distribute rays evenly")
-	raysCentered = flag.Bool("raysCentered", true, "Center rays in middle")
-	raysDrawLargestToSmallest = flag.Bool("raysLargeToSmall", false, "Order rays z-index by size (smaller rays are drawn on top of larger rays)")
-
-	// Stripes image output options
-	stripesSize = flag.Int("stripesSize", 6, "Size of stripes in output image")
-	stripesSizeVariance = flag.Int("stripesSizeVariance", 3, "Maximum variance in stripes size")
-	stripesHorizontal = flag.Bool("stripesHorizontal", false, "Draw stripes horizontally instead of vertically")
-	stripesEvenSpacing = flag.Bool("stripesEvenSpacing", true, "Space all stripes evenly")
-	stripesSpacing = flag.Int("stripesSpacing", 0, "Space stripes by this amount when spacing evenly")
-	stripesOffset = flag.Int("stripesOffset", 0, "Offset stripes by this amount")
-
-	advancedoptions = flag.Bool("help-advanced", false, "Show advanced command line options")
-
-	flag.Usage = flags_usage
-	flag.Parse()
-	if *advancedoptions {
-		flags_usage()
-		os.Exit(1)
+	if *threshold > 255 {
+		return errors.New("Threshold should be an integer between 0 and 255.")
 	}
-	if *format_string == "" {
-		fmt.Println("Input and output format must be specified using '-format' flag.")
-		flags_usage()
-		os.Exit(2)
+	if *imageWidth < 100 || *imageHeight < 100 {
+		return errors.New("Minimum resolution of image output is 100x100")
 	}
-	if *infile == "" {
-		fmt.Println("Input file must be provided using '-in' flag.")
-		flags_usage()
-		os.Exit(2)
+	if *antialias < 1 || *antialias > maxAntialias {
+		return fmt.Errorf("Anti-aliasing factor must be an integer between 1 and %d.", maxAntialias)
 	}
-	if *minBrightness > 255 || *maxBrightness > 255 {
-		fmt.Print("Minimum and maximum brightness must be an integer between 0 and 255.\n")
-		os.Exit(2)
+	if !isOption(*oscPassthrough, oscPassthroughModes[:]) {
+		return errors.New("Unrecognised OSC passthrough mode: " + *oscPassthrough)
 	}
-	if *threshold > 255 {
-		fmt.Print("Threshold should be an integer between 0 and 255.\n")
-		os.Exit(2)
+	if *backupCount < 0 {
+		return errors.New("Backup count must be 0 or more.")
 	}
+	if *overlayOpacity < 0 || *overlayOpacity > 100 {
+		return errors.New("Overlay opacity must be an integer between 0 and 100.")
+	}
+	if *overlayScale < 0 {
+		return errors.New("Overlay scale must be a positive percentage of the image height, or 0 to keep the overlay's size.")
+	}
+	return nil
+}
 
-	if *imageWidth < 100 || *imageHeight < 100 {
-		log.Fatal("Minimum resolution of image output is 100x100")
+// writeResult writes output to filename if one is specified,
+// otherwise it is written to stdout.
+// This replaces the whole file; see mergeResult for keeping the rest of a config file.
+// The file is backed up first, unless disabled with -backup=false.
+func writeResult(filename string, result string) error {
+	if filename == "" {
+		fmt.Print(result)
+		return nil
+	}
+	if *showDiff {
+		current, err := readFile(filename)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if isBinary(result) {
+			// Binary files can't be compared line by line
+			fmt.Printf("Would write %d bytes to %v\n", len(result), filename)
+			return nil
+		}
+		changes := unifiedDiff(filename, current, result)
+		if changes == "" {
+			changes = "No changes to " + filename + "\n"
+		}
+		fmt.Print(changes)
+		return nil
 	}
+	// Output templates can name directories that don't exist yet
+	err := os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		return err
+	}
+	if *backup {
+		err := backupFile(filename)
+		if err != nil {
+			return errors.New("Could not back up " + filename + ": " + err.Error())
+		}
+	}
+	return writeFileAtomic(filename, []byte(result))
+}
 
-	// Determine format and filenames
-	// And get colors from file using specified format
-	if len(strings.SplitN(*format_string, format_separator, 2)) < 2 {
-		fmt.Println("Invalid format string. Separate input and output formats with: '" + format_separator + "'")
-		flags_usage()
-		os.Exit(2)
+// mergeResult splices output into the existing contents of filename,
+// so that only the colors change. If the file doesn't exist yet,
+// output is returned as it is.
+func mergeResult(f Format, filename string, output string) (string, error) {
+	if filename == "" {
+		return "", errors.New("Merging requires an output file, given with the '-out' flag.")
 	}
-	input_format := strings.SplitN(*format_string, format_separator, 2)[0]
-	output_format := strings.SplitN(*format_string, format_separator, 2)[1]
+	if f.merge == nil {
+		return "", errors.New("Merging is not supported for format " + f.flagName)
+	}
+	config, err := readFile(filename)
+	if os.IsNotExist(err) {
+		return output, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return f.merge(config, output)
+}
 
-	formatInMatch := false
-	var colors []color.Color
-	var err error
-	for _, f := range formats {
-		if input_format == f.flagName {
-			if f.input == nil {
-				fmt.Printf("Unrecognised input format: %v \n", input_format)
-				return
-			}
-			colors, err = f.input(*infile)
-			if err != nil {
-				fmt.Print(err, "\n")
-				return
-			}
-			formatInMatch = true
-			break
-		}
+// readColors reads a scheme from filename in the given input format.
+// The scheme is repeated or truncated to make exactly 16 colors.
+func readColors(input_format string, filename string) ([]color.Color, error) {
+	f, ok := findFormat(input_format)
+	if !ok {
+		return nil, errors.New("Did not recognise format " + input_format + ".")
+	}
+	if f.input == nil {
+		return nil, errors.New("Unrecognised input format: " + input_format)
+	}
+	colors, err := f.input(filename)
+	if err != nil {
+		return nil, err
 	}
-	if !formatInMatch {
-		fmt.Printf("Did not recognise format %v. \n", input_format)
-		return
+	if len(colors) == 0 {
+		return nil, errors.New("No colors found in " + filename)
 	}
+	colors = normalizeColors(colors)
 
 	// Keep track of the original number of colors
 	// In case we need to add more to meet 16
@@ -216,66 +434,176 @@ func main() {
 			colors = append(colors, colors[i%num_colors])
 		}
 	}
+	return colors, nil
+}
 
+// writeColors writes a scheme in the given output format to filename,
+// or to stdout if filename is empty.
+func writeColors(output_format string, colors []color.Color, filename string) error {
+	colors = normalizeColors(colors)
 	// Output the configuration for terminal, or image
-	if output_format != "img" {
-		formatOutMatch := false
-		for _, f := range formats {
-			if output_format == f.flagName {
-				if f.output == nil {
-					fmt.Printf("Unrecognised output format: %v \n", output_format)
-					return
-				}
-				result := f.output(colors)
-				// If outfile is specified, write output to file
-				// Otherwise, write to stdout.
-				// TODO: Make it abundantly clear that the output is *only* the colors
-				// and attempting to write directly to a config file will overwrite all other
-				// data in the config file.
-				if *outfile != "" {
-					file, err := os.OpenFile(*outfile, os.O_CREATE|os.O_WRONLY, 0666)
-					if err != nil {
-						fmt.Println(err)
-						os.Exit(1)
-					}
-					defer file.Close()
-					err = file.Truncate(0)
-					if err != nil {
-						fmt.Println(err)
-						os.Exit(1)
-					}
-					fmt.Fprint(file, result)
-				} else {
-					fmt.Printf(result)
-				}
-				formatOutMatch = true
-				break
-			}
+	if output_format == "osc" && *oscAllTTYs {
+		return writeAllTTYs(colors)
+	}
+	if output_format == "osc" && *showDiff {
+		// Printing the sequences, or a diff of them, would change this terminal's colors
+		destination := "this terminal"
+		if filename != "" {
+			destination = filename
 		}
-		if !formatOutMatch {
-			fmt.Printf("Did not recognise format %v. \n", output_format)
+		if mode := oscPassthroughMode(); mode != "none" {
+			destination += ", each wrapped to pass through " + mode
 		}
-	} else {
-		var file *os.File
+		describeOSC(oscSequences(colors, "none"), destination)
+		return nil
+	}
+	f, ok := findFormat(output_format)
+	if !ok {
+		return errors.New("Did not recognise format " + output_format + ".")
+	}
+	if f.render != nil {
+		return writeImage(f.render, output_format, colors, filename)
+	}
+	if f.output == nil {
+		return errors.New("Unrecognised output format: " + output_format)
+	}
+	result := f.output(colors)
+	if *merge {
 		var err error
-		if *outfile == "" {
-			fmt.Println("Warning: Image output requested, yet no output file provided.")
-			fmt.Println("Writing image data to /tmp/schemer_out.png")
-			file, err = os.OpenFile("/tmp/schemer_out.png", os.O_CREATE|os.O_WRONLY, 0666)
-		} else {
-			file, err = os.OpenFile(*outfile, os.O_CREATE|os.O_WRONLY, 0666)
+		result, err = mergeResult(f, filename, result)
+		if err != nil {
+			return err
 		}
+	}
+	return writeResult(filename, result)
+}
+
+// writeImage generates an image from the colors, and writes it with a scene backend
+func writeImage(render renderFunction, output_format string, colors []color.Color, filename string) error {
+	w, h := *imageWidth, *imageHeight
+	var monitorList []image.Rectangle
+	var desktop image.Rectangle
+	if *monitors != "" {
+		var err error
+		monitorList, err = parseMonitors(*monitors)
 		if err != nil {
-			log.Fatal(err)
+			return err
+		}
+		desktop = desktopBounds(monitorList)
+		w, h = desktop.Dx(), desktop.Dy()
+	}
+	if *monitorsSplit && (output_format != "img" || monitorList == nil) {
+		return errors.New("Splitting by monitor requires image output and the '-monitors' flag.")
+	}
+
+	if output_format == "img" && *showDiff {
+		// Comparing images line by line isn't useful, so describe the image instead
+		if *monitorsSplit {
+			for i, m := range monitorList {
+				fmt.Printf("Would write %dx%d PNG image to %v\n", m.Dx(), m.Dy(), monitorFilename(filename, i))
+			}
+		} else {
+			fmt.Printf("Would write %dx%d PNG image to %v\n", w, h, filename)
 		}
-		defer file.Close()
+		fmt.Print("Palette:\n", printColors(colors))
+		return nil
+	}
 
-		img, err := imageFromColors(colors, *imageWidth, *imageHeight) // TODO
+	scene, err := newScene(colors, w, h)
+	if err != nil {
+		return err
+	}
+
+	if *monitorsSplit {
+		img, err := renderOverlaid(scene, w, h)
 		if err != nil {
-			fmt.Printf(err.Error())
-			os.Exit(1)
+			return err
+		}
+		for i, monitorImg := range cropMonitors(img, desktop, monitorList) {
+			var buf bytes.Buffer
+			err = png.Encode(&buf, monitorImg)
+			if err != nil {
+				return err
+			}
+			err = writeResult(monitorFilename(filename, i), buf.String())
+			if err != nil {
+				return err
+			}
 		}
+		return nil
+	}
+
+	var buf bytes.Buffer
+	err = render(scene, w, h, &buf)
+	if err != nil {
+		return err
+	}
+	return writeResult(filename, buf.String())
+}
+
+// legacyMain runs the original form of the command line, with every
+// option available and the formats given as -format input::output
+func legacyMain() error {
+	for _, g := range flagGroups {
+		g.register(flag.CommandLine)
+	}
+	flag.StringVar(format_string, "format", "", "Format of input and output, with several output formats separated by commas. Eg. 'img"+format_separator+"xterm,kitty'")
+	flag.BoolVar(advancedoptions, "help-advanced", false, "Show advanced command line options")
+
+	flag.Usage = flags_usage
+	flag.Parse()
+	if *advancedoptions {
+		flags_usage()
+		os.Exit(1)
+	}
+	_, err := applyConfig(flag.CommandLine)
+	if err != nil {
+		return err
+	}
+	if *format_string == "" {
+		fmt.Println("Input and output format must be specified using '-format' flag.")
+		flags_usage()
+		os.Exit(2)
+	}
+	// Live input defaults to the current terminal
+	if *infile == "" && !strings.HasPrefix(*format_string, "live"+format_separator) {
+		fmt.Println("Input file must be provided using '-in' flag.")
+		flags_usage()
+		os.Exit(2)
+	}
+	err = validateOptions()
+	if err != nil {
+		return err
+	}
+
+	// Determine format and filenames
+	// And get colors from file using specified format
+	if len(strings.SplitN(*format_string, format_separator, 2)) < 2 {
+		fmt.Println("Invalid format string. Separate input and output formats with: '" + format_separator + "'")
+		flags_usage()
+		os.Exit(2)
+	}
+	input_format := strings.SplitN(*format_string, format_separator, 2)[0]
+	output_format := strings.SplitN(*format_string, format_separator, 2)[1]
+
+	targets, err := outputTargets(output_format, *outfile, *manifestFile)
+	if err != nil {
+		return err
+	}
+	return runOrWatch(input_format, *infile, targets)
+}
 
-		png.Encode(file, img)
+func main() {
+	registerDefaults()
+
+	var err error
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		err = runCommand(os.Args[1], os.Args[2:])
+	} else {
+		err = legacyMain()
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+type mergeFunction (func(config string, output string) (string, error))
+
+// mergeKeys splices the lines of output into config.
+// keyOf returns the setting a line sets, or "" for lines that don't set a color.
+// Each line of config is replaced by the line of output with the same key,
+// through splice if it isn't nil, and everything else in config is left untouched. Lines of output for keys that
+// config doesn't have yet are added after the section header, if there is one,
+// or at the end of the file.
+func mergeKeys(config string, output string, keyOf func(line string) string, splice func(existing string, replacement string) string, section string) string {
+	newLines := make(map[string]string)
+	order := make([]string, 0)
+	for _, l := range strings.Split(strings.TrimRight(output, "\n"), "\n") {
+		key := keyOf(l)
+		if key == "" {
+			continue
+		}
+		if _, ok := newLines[key]; !ok {
+			order = append(order, key)
+		}
+		newLines[key] = l
+	}
+
+	lines := strings.Split(config, "\n")
+	found := make(map[string]bool)
+	for i, l := range lines {
+		key := keyOf(l)
+		if replacement, ok := newLines[key]; ok && key != "" {
+			if splice != nil {
+				replacement = splice(l, replacement)
+			}
+			lines[i] = replacement
+			found[key] = true
+		}
+	}
+
+	missing := make([]string, 0)
+	for _, key := range order {
+		if !found[key] {
+			missing = append(missing, newLines[key])
+		}
+	}
+	if len(missing) == 0 {
+		return strings.Join(lines, "\n")
+	}
+
+	if section != "" {
+		for i, l := range lines {
+			if strings.TrimSpace(l) == section {
+				merged := append([]string{}, lines[:i+1]...)
+				merged = append(merged, missing...)
+				merged = append(merged, lines[i+1:]...)
+				return strings.Join(merged, "\n")
+			}
+		}
+		missing = append([]string{section}, missing...)
+	}
+
+	// Add to the end, keeping the file's trailing newline
+	config = strings.TrimRight(strings.Join(lines, "\n"), "\n")
+	if config != "" {
+		config += "\n"
+	}
+	return config + strings.Join(missing, "\n") + "\n"
+}
+
+// keyMatcher returns a function giving the key of lines matching re.
+// The key is made from the submatches of re, so that lines with different
+// spacing set the same key.
+func keyMatcher(re *regexp.Regexp) func(line string) string {
+	return func(line string) string {
+		m := re.FindStringSubmatch(line)
+		if m == nil {
+			return ""
+		}
+		return "=" + strings.Join(m[1:], ",")
+	}
+}
+
+func mergeXfce(config string, output string) (string, error) {
+	re := regexp.MustCompile(`^\s*(ColorPalette|BackgroundMode|BackgroundDarkness)\s*=`)
+	return mergeKeys(config, output, keyMatcher(re), nil, "[Configuration]"), nil
+}
+
+func mergeLilyTerm(config string, output string) (string, error) {
+	re := regexp.MustCompile(`^\s*Color([0-9]+)\s*=`)
+	return mergeKeys(config, output, keyMatcher(re), nil, ""), nil
+}
+
+func mergeTermite(config string, output string) (string, error) {
+	re := regexp.MustCompile(`^\s*(color[0-9]+|background)\s*=`)
+	return mergeKeys(config, output, keyMatcher(re), nil, "[colors]"), nil
+}
+
+func mergeXterm(config string, output string) (string, error) {
+	// Any resource setting colorN, such as *color1, *.color1 or URxvt.color1,
+	// or the depth and background used for transparency
+	re := regexp.MustCompile(`^\s*([A-Za-z_*.-]*[*.](color[0-9]+|depth|background))\s*:`)
+	keyOf := func(line string) string {
+		m := re.FindStringSubmatch(line)
+		if m == nil {
+			return ""
+		}
+		// Only urxvt understands the depth and the alpha of the background it
+		// is given, so other programs' settings of them are left alone
+		if !strings.HasPrefix(m[2], "color") && resourcePrecedence(m[1], urxvtClasses) == 0 {
+			return ""
+		}
+		return "=" + m[2]
+	}
+	return mergeKeys(config, output, keyOf, keepResourceName, ""), nil
+}
+
+// keepResourceName gives an existing resource line the value of the
+// replacement, keeping its own resource name, so that Eg. "URxvt.color1"
+// still only applies to urxvt.
+func keepResourceName(existing string, replacement string) string {
+	colon := strings.Index(existing, ":")
+	value := strings.TrimSpace(replacement[strings.Index(replacement, ":")+1:])
+	rest := existing[colon+1:]
+	space := rest[:len(rest)-len(strings.TrimLeft(rest, " \t"))]
+	return existing[:colon+1] + space + value
+}
+
+func mergeKittyTerm(config string, output string) (string, error) {
+	re := regexp.MustCompile(`^\s*(color[0-9]+|background_opacity)\s`)
+	return mergeKeys(config, output, keyMatcher(re), nil, ""), nil
+}
+
+// mergeTerminator replaces the palette of the profile named by -mergeProfile,
+// leaving other profiles alone.
+func mergeTerminator(config string, output string) (string, error) {
+	palette := strings.TrimRight(output, "\n")
+	profileHeader := regexp.MustCompile(`^\s*\[\[\s*(.*?)\s*\]\]\s*$`)
+	topSection := regexp.MustCompile(`^\s*\[[^\[].*\]\s*$`)
+	paletteLine := regexp.MustCompile(`^(\s*)palette\s*=`)
+
+	lines := strings.Split(config, "\n")
+	inProfiles := false
+	profileStart := -1
+	indent := "    "
+	for i, l := range lines {
+		if topSection.MatchString(l) {
+			inProfiles = strings.TrimSpace(l) == "[profiles]"
+			if profileStart >= 0 {
+				break
+			}
+			continue
+		}
+		if m := profileHeader.FindStringSubmatch(l); m != nil {
+			if profileStart >= 0 {
+				break
+			}
+			if inProfiles && m[1] == *mergeProfile {
+				profileStart = i
+			}
+			continue
+		}
+		if profileStart < 0 {
+			continue
+		}
+		if m := paletteLine.FindStringSubmatch(l); m != nil {
+			lines[i] = m[1] + palette
+			return strings.Join(lines, "\n"), nil
+		}
+		if strings.TrimSpace(l) != "" {
+			indent = l[:len(l)-len(strings.TrimLeft(l, " \t"))]
+		}
+	}
+
+	if profileStart < 0 {
+		return "", errors.New("Profile '" + *mergeProfile + "' not found in Terminator config")
+	}
+	// The profile has no palette yet, so add one at the start of it
+	merged := append([]string{}, lines[:profileStart+1]...)
+	merged = append(merged, indent+palette)
+	merged = append(merged, lines[profileStart+1:]...)
+	return strings.Join(merged, "\n"), nil
+}
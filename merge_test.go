@@ -0,0 +1,83 @@
+package main
+
+import "testing"
+
+func TestMergeXtermKeepsResourceNames(t *testing.T) {
+	config := "! mine\nURxvt.color1: #111111\n*color1:\t#222222\nURxvt.font: mono\n"
+	output := "! Terminal colors\n*color1: #cc6666\n*color2: #00ff00\n"
+	expected := "! mine\nURxvt.color1: #cc6666\n*color1:\t#cc6666\nURxvt.font: mono\n*color2: #00ff00\n"
+
+	merged, err := mergeXterm(config, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged != expected {
+		t.Errorf("Merged into:\n%v\nexpected:\n%v", merged, expected)
+	}
+}
+
+// Each merge replaces the colors in place, adds the ones config doesn't have,
+// and leaves comments, other settings and the order of lines untouched
+var mergeTests = []struct {
+	format   string
+	config   string
+	output   string
+	expected string
+}{
+	{
+		"urxvt",
+		"! shared\nXTerm*background: black\nEmacs.background: white\n*background: #000000\nURxvt.depth: 24\nXTerm*depth: 8\n",
+		"URxvt*color0: #102030\nURxvt*depth: 32\nURxvt*background: [80]#102030\n",
+		"! shared\nXTerm*background: black\nEmacs.background: white\n*background: [80]#102030\nURxvt.depth: 32\nXTerm*depth: 8\nURxvt*color0: #102030\n",
+	},
+	{
+		"kitty",
+		"# my theme\nfont_size 12\ncolor1 #000000\nmap ctrl+c copy\ncolor0 #111111\n",
+		"color0\t#aaaaaa\ncolor1\t#bbbbbb\ncolor2\t#cccccc\nbackground_opacity\t0.85\n",
+		"# my theme\nfont_size 12\ncolor1\t#bbbbbb\nmap ctrl+c copy\ncolor0\t#aaaaaa\ncolor2\t#cccccc\nbackground_opacity\t0.85\n",
+	},
+	{
+		"xfce",
+		"[Configuration]\nFontName=Mono 10\n# note\nColorPalette=#000000;#111111\nMiscBell=FALSE\n",
+		"ColorPalette=#aaaaaa;#bbbbbb\nBackgroundMode=TERMINAL_BACKGROUND_TRANSPARENT\nBackgroundDarkness=0.85\n",
+		"[Configuration]\nBackgroundMode=TERMINAL_BACKGROUND_TRANSPARENT\nBackgroundDarkness=0.85\nFontName=Mono 10\n# note\nColorPalette=#aaaaaa;#bbbbbb\nMiscBell=FALSE\n",
+	},
+	{
+		"termite",
+		"[options]\nfont = Mono 9\n\n[colors]\n# dark\nforeground = #ffffff\ncolor0 = #000000\n",
+		"color0 = #111111\ncolor1 = #222222\nbackground = rgba(1, 2, 3, 0.85)\n",
+		"[options]\nfont = Mono 9\n\n[colors]\ncolor1 = #222222\nbackground = rgba(1, 2, 3, 0.85)\n# dark\nforeground = #ffffff\ncolor0 = #111111\n",
+	},
+	{
+		"lilyterm",
+		"# LilyTerm\nfont_name = Mono 10\nColor0 = #000000\nscrollback_lines = 1024\n",
+		"Color0 = #111111\nColor1 = #222222\n",
+		"# LilyTerm\nfont_name = Mono 10\nColor0 = #111111\nscrollback_lines = 1024\nColor1 = #222222\n",
+	},
+	{
+		"terminator",
+		"[global_config]\n  # keep\n[profiles]\n  [[other]]\n    palette = \"#000000:#111111\"\n  [[default]]\n    font = Mono 10\n    palette = \"#000000:#222222\"\n    cursor_color = \"#ffffff\"\n[layouts]\n",
+		"palette = \"#aaaaaa:#bbbbbb\"\n",
+		"[global_config]\n  # keep\n[profiles]\n  [[other]]\n    palette = \"#000000:#111111\"\n  [[default]]\n    font = Mono 10\n    palette = \"#aaaaaa:#bbbbbb\"\n    cursor_color = \"#ffffff\"\n[layouts]\n",
+	},
+}
+
+func TestMerge(t *testing.T) {
+	saved := *mergeProfile
+	*mergeProfile = "default"
+	t.Cleanup(func() {
+		*mergeProfile = saved
+	})
+
+	for _, test := range mergeTests {
+		f, _ := findFormat(test.format)
+		merged, err := f.merge(test.config, test.output)
+		if err != nil {
+			t.Errorf("%v: %v", test.format, err)
+			continue
+		}
+		if merged != test.expected {
+			t.Errorf("%v merged into:\n%v\nexpected:\n%v", test.format, merged, test.expected)
+		}
+	}
+}
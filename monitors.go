@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// parseMonitors reads a list of monitor geometries, in the same form as
+// xrandr: WIDTHxHEIGHT+X+Y, separated by commas.
+// Eg, "2560x1440+0+0,1920x1080+2560+180"
+func parseMonitors(s string) ([]image.Rectangle, error) {
+	monitors := make([]image.Rectangle, 0)
+	for _, geometry := range strings.Split(s, ",") {
+		geometry = strings.TrimSpace(geometry)
+		size := strings.SplitN(geometry, "+", 2)
+		dimensions := strings.SplitN(size[0], "x", 2)
+		if len(size) < 2 || len(dimensions) < 2 {
+			return nil, errors.New("Invalid monitor geometry: " + geometry + ". Use WIDTHxHEIGHT+X+Y")
+		}
+		offsets := strings.SplitN(size[1], "+", 2)
+		if len(offsets) < 2 {
+			return nil, errors.New("Invalid monitor geometry: " + geometry + ". Use WIDTHxHEIGHT+X+Y")
+		}
+
+		values := make([]int, 0, 4)
+		for _, v := range []string{dimensions[0], dimensions[1], offsets[0], offsets[1]} {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, errors.New("Invalid monitor geometry: " + geometry + ". Use WIDTHxHEIGHT+X+Y")
+			}
+			values = append(values, n)
+		}
+		if values[0] < 1 || values[1] < 1 {
+			return nil, errors.New("Invalid monitor geometry: " + geometry + ". Width and height must be positive")
+		}
+		monitors = append(monitors, image.Rect(values[2], values[3], values[2]+values[0], values[3]+values[1]))
+	}
+	return monitors, nil
+}
+
+// desktopBounds returns the smallest rectangle containing every monitor
+func desktopBounds(monitors []image.Rectangle) image.Rectangle {
+	bounds := monitors[0]
+	for _, m := range monitors[1:] {
+		bounds = bounds.Union(m)
+	}
+	return bounds
+}
+
+// monitorFilename inserts the monitor number before the extension of filename.
+// Eg, "wallpaper.png" becomes "wallpaper-1.png"
+func monitorFilename(filename string, n int) string {
+	ext := filepath.Ext(filename)
+	return strings.TrimSuffix(filename, ext) + "-" + strconv.Itoa(n) + ext
+}
+
+// cropMonitors cuts a rendered image of the whole desktop into an image for each monitor
+func cropMonitors(img image.Image, desktop image.Rectangle, monitors []image.Rectangle) []image.Image {
+	type subImager interface {
+		SubImage(r image.Rectangle) image.Image
+	}
+	images := make([]image.Image, 0, len(monitors))
+	for _, m := range monitors {
+		// The rendered image starts at 0,0 rather than the top left of the desktop
+		r := m.Sub(desktop.Min)
+		images = append(images, img.(subImager).SubImage(r))
+	}
+	return images
+}
+
+// overlayArea returns the part of a rendered image that overlays are placed in.
+// This is the first monitor when monitors are given, otherwise the whole image.
+func overlayArea(bounds image.Rectangle) image.Rectangle {
+	if *monitors == "" {
+		return bounds
+	}
+	monitorList, err := parseMonitors(*monitors)
+	if err != nil {
+		return bounds
+	}
+	return monitorList[0].Sub(desktopBounds(monitorList).Min)
+}
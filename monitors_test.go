@@ -0,0 +1,91 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestParseMonitors(t *testing.T) {
+	for _, test := range []struct {
+		monitors string
+		expected []image.Rectangle
+	}{
+		{"1920x1080+0+0", []image.Rectangle{image.Rect(0, 0, 1920, 1080)}},
+		{"2560x1440+0+0,1920x1080+2560+180", []image.Rectangle{image.Rect(0, 0, 2560, 1440), image.Rect(2560, 180, 4480, 1260)}},
+		{" 1080x1920+0+0 , 1920x1080+1080+420 ", []image.Rectangle{image.Rect(0, 0, 1080, 1920), image.Rect(1080, 420, 3000, 1500)}},
+		{"1920x1080+1920+0,1920x1080+0+0", []image.Rectangle{image.Rect(1920, 0, 3840, 1080), image.Rect(0, 0, 1920, 1080)}},
+	} {
+		got, err := parseMonitors(test.monitors)
+		if err != nil {
+			t.Errorf("%q: %v", test.monitors, err)
+		} else if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%q parsed as %v, expected %v", test.monitors, got, test.expected)
+		}
+	}
+
+	for _, bad := range []string{"", "1920x1080", "1920x1080+0", "1920+0+0", "axb+0+0", "1920x1080+a+0", "0x1080+0+0", "1920x-1+0+0", "1920x1080+0+0,"} {
+		if _, err := parseMonitors(bad); err == nil {
+			t.Errorf("parseMonitors(%q) should fail", bad)
+		}
+	}
+}
+
+func TestSplitMonitors(t *testing.T) {
+	monitorList, err := parseMonitors("1920x1080+1920+100,1920x1200+0+0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	desktop := desktopBounds(monitorList)
+	if expected := image.Rect(0, 0, 3840, 1200); desktop != expected {
+		t.Errorf("Desktop is %v, expected %v", desktop, expected)
+	}
+
+	// Each monitor's image is the part of the desktop it shows
+	img := image.NewNRGBA(image.Rect(0, 0, desktop.Dx(), desktop.Dy()))
+	img.SetNRGBA(1920, 100, color.NRGBA{255, 0, 0, 255})
+	img.SetNRGBA(0, 1199, color.NRGBA{0, 255, 0, 255})
+	images := cropMonitors(img, desktop, monitorList)
+	if len(images) != 2 {
+		t.Fatalf("Cropped into %d images", len(images))
+	}
+	for i, test := range []struct {
+		size   image.Point
+		corner image.Point
+		col    color.NRGBA
+	}{
+		{image.Pt(1920, 1080), image.Pt(0, 0), color.NRGBA{255, 0, 0, 255}},
+		{image.Pt(1920, 1200), image.Pt(0, 1199), color.NRGBA{0, 255, 0, 255}},
+	} {
+		b := images[i].Bounds()
+		if b.Size() != test.size {
+			t.Errorf("Monitor %d image is %v, expected %v", i, b.Size(), test.size)
+		}
+		if got := nrgba(images[i].At(b.Min.X+test.corner.X, b.Min.Y+test.corner.Y)); got != test.col {
+			t.Errorf("Monitor %d has %v at %v, expected %v", i, got, test.corner, test.col)
+		}
+	}
+
+	// The overlay goes on the first monitor
+	registerDefaults()
+	saved := *monitors
+	*monitors = "1920x1080+1920+100,1920x1200+0+0"
+	t.Cleanup(func() { *monitors = saved })
+	if area := overlayArea(img.Bounds()); area != image.Rect(1920, 100, 3840, 1180) {
+		t.Errorf("Overlay area is %v", area)
+	}
+
+	for _, test := range []struct {
+		filename string
+		expected string
+	}{
+		{"wallpaper.png", "wallpaper-1.png"},
+		{"/tmp/a.b/wall", "/tmp/a.b/wall-1"},
+		{"~/wall.paper.png", "~/wall.paper-1.png"},
+	} {
+		if got := monitorFilename(test.filename, 1); got != test.expected {
+			t.Errorf("monitorFilename(%q) = %q, expected %q", test.filename, got, test.expected)
+		}
+	}
+}
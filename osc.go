@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Palette slots used for the special colors of terminals that have them
+const (
+	backgroundSlot = 0
+	foregroundSlot = 7
+	selectionSlot  = 8
+)
+
+var oscPassthroughModes = [...]string{"auto", "tmux", "screen", "none"}
+
+// oscColor formats a color as an X11 color specification, as used by OSC
+// sequences, keeping all 16 bits of each channel
+func oscColor(c color.Color) string {
+	cc := nrgba64(c)
+	return fmt.Sprintf("rgb:%04x/%04x/%04x", cc.R, cc.G, cc.B)
+}
+
+// oscPassthroughMode works out how escape sequences need wrapping to reach
+// the terminal, when running inside tmux or screen.
+func oscPassthroughMode() string {
+	if *oscPassthrough != "auto" {
+		return *oscPassthrough
+	}
+	if os.Getenv("TMUX") != "" {
+		return "tmux"
+	}
+	if strings.HasPrefix(os.Getenv("TERM"), "screen") {
+		return "screen"
+	}
+	return "none"
+}
+
+// oscWrap wraps an escape sequence so that tmux or screen pass it
+// through to the terminal they are running in.
+func oscWrap(seq string, passthrough string) string {
+	switch passthrough {
+	case "tmux":
+		return "\033Ptmux;" + strings.Replace(seq, "\033", "\033\033", -1) + "\033\\"
+	case "screen":
+		return "\033P" + seq + "\033\\"
+	}
+	return seq
+}
+
+// oscSequences returns the escape sequences to set the palette (OSC 4),
+// foreground (OSC 10), background (OSC 11), cursor (OSC 12) and
+// selection (OSC 17) colors of a terminal.
+func oscSequences(colors []color.Color, passthrough string) string {
+	output := ""
+	for i, c := range colors {
+		output += oscWrap("\033]4;"+strconv.Itoa(i)+";"+oscColor(c)+"\033\\", passthrough)
+	}
+	// Special colors are only set when the scheme has the slot they come from
+	for _, special := range []struct {
+		code string
+		slot int
+	}{{"10", foregroundSlot}, {"11", backgroundSlot}, {"12", foregroundSlot}, {"17", selectionSlot}} {
+		if special.slot < len(colors) {
+			output += oscWrap("\033]"+special.code+";"+oscColor(colors[special.slot])+"\033\\", passthrough)
+		}
+	}
+	return output
+}
+
+func printOSC(colors []color.Color) string {
+	return oscSequences(colors, oscPassthroughMode())
+}
+
+// describeOSC prints escape sequences one per line, quoted, instead of
+// sending them, for -diff.
+func describeOSC(seq string, destination string) {
+	fmt.Println("Would send these escape sequences to " + destination + ":")
+	for _, s := range strings.SplitAfter(seq, "\033\\") {
+		if s != "" {
+			fmt.Println(strconv.Quote(s))
+		}
+	}
+}
+
+// writeAllTTYs sends the escape sequences to every pseudo-terminal,
+// so that all open terminals change colors at once.
+func writeAllTTYs(colors []color.Color) error {
+	ttys, err := filepath.Glob("/dev/pts/[0-9]*")
+	if err != nil {
+		return err
+	}
+	if len(ttys) == 0 {
+		return errors.New("No terminals found in /dev/pts")
+	}
+	// Each terminal is written to directly, so there is no tmux or screen to pass through
+	seq := oscSequences(colors, "none")
+	if *showDiff {
+		describeOSC(seq, strings.Join(ttys, ", "))
+		return nil
+	}
+	return writeTTYs(ttys, seq)
+}
+
+// writeTTYs writes seq to each terminal that can be written to, failing
+// only if none of them can.
+func writeTTYs(ttys []string, seq string) error {
+	written := 0
+	for _, tty := range ttys {
+		file, err := os.OpenFile(tty, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			// Terminals belonging to other users can't be written to
+			continue
+		}
+		_, err = fmt.Fprint(file, seq)
+		file.Close()
+		if err == nil {
+			written++
+		}
+	}
+	if written == 0 {
+		return errors.New("Could not write to any of the terminals in /dev/pts")
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"image/color"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestOSCSequencesFewColors checks that special colors are left out when
+// the scheme doesn't have the slots they come from.
+func TestOSCSequencesFewColors(t *testing.T) {
+	colors := []color.Color{color.Black, color.White, color.Black}
+	seq := oscSequences(colors, "none")
+	if strings.Count(seq, "\033]4;") != 3 {
+		t.Errorf("Expected 3 palette colors in %q", seq)
+	}
+	if !strings.Contains(seq, "\033]11;rgb:0000/0000/0000") {
+		t.Errorf("Expected the background from color0 in %q", seq)
+	}
+	for _, code := range []string{"10", "12", "17"} {
+		if strings.Contains(seq, "\033]"+code+";") {
+			t.Errorf("OSC %v set without its slot in %q", code, seq)
+		}
+	}
+}
+
+func TestWriteTTYs(t *testing.T) {
+	dir := t.TempDir()
+	missing := []string{filepath.Join(dir, "1"), filepath.Join(dir, "2")}
+	if err := writeTTYs(missing, "seq"); err == nil {
+		t.Error("Expected an error when no terminal could be written")
+	}
+
+	tty := filepath.Join(dir, "3")
+	err := ioutil.WriteFile(tty, nil, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeTTYs(append(missing, tty), "seq"); err != nil {
+		t.Error(err)
+	}
+	if written, _ := ioutil.ReadFile(tty); string(written) != "seq" {
+		t.Errorf("Wrote %q", written)
+	}
+}
+
+func TestValidateOSCPassthrough(t *testing.T) {
+	registerDefaults()
+	saved := *oscPassthrough
+	t.Cleanup(func() { *oscPassthrough = saved })
+	for _, mode := range oscPassthroughModes {
+		*oscPassthrough = mode
+		if err := validateOptions(); err != nil {
+			t.Errorf("%v: %v", mode, err)
+		}
+	}
+	*oscPassthrough = "tmuxx"
+	if err := validateOptions(); err == nil {
+		t.Error("Expected an error for an unknown passthrough mode")
+	}
+}
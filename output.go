@@ -8,16 +8,35 @@ import (
 	"strconv"
 )
 
+// backgroundOpacity returns the alpha of the background color, from 0 to 1.
+// Formats that support a transparent background are given it as their
+// transparency setting.
+func backgroundOpacity(colors []color.Color) float64 {
+	if len(colors) <= backgroundSlot {
+		return 1
+	}
+	return opacity(colors[backgroundSlot])
+}
+
+// formatOpacity formats an opacity from 0 to 1, Eg. "0.85"
+func formatOpacity(alpha float64) string {
+	return strconv.FormatFloat(alpha, 'f', 2, 64)
+}
+
 func printXfce(colors []color.Color) string {
 	output := ""
 	output += "ColorPalette="
 	for _, c := range colors {
-		bytes := []byte{byte(c.(color.NRGBA).R), byte(c.(color.NRGBA).R), byte(c.(color.NRGBA).G), byte(c.(color.NRGBA).G), byte(c.(color.NRGBA).B), byte(c.(color.NRGBA).B)}
-		output += "#"
-		output += hex.EncodeToString(bytes)
+		// XFCE keeps 16 bits per channel
+		cc := nrgba64(c)
+		output += fmt.Sprintf("#%04x%04x%04x", cc.R, cc.G, cc.B)
 		output += ";"
 	}
 	output += "\n"
+	if alpha := backgroundOpacity(colors); alpha < 1 {
+		output += "BackgroundMode=TERMINAL_BACKGROUND_TRANSPARENT\n"
+		output += "BackgroundDarkness=" + formatOpacity(alpha) + "\n"
+	}
 
 	return output
 }
@@ -25,7 +44,7 @@ func printXfce(colors []color.Color) string {
 func printLilyTerm(colors []color.Color) string {
 	output := ""
 	for i, c := range colors {
-		cc := c.(color.NRGBA)
+		cc := nrgba(c)
 		bytes := []byte{byte(cc.R), byte(cc.G), byte(cc.B)}
 		output += "Color"
 		output += strconv.Itoa(i)
@@ -40,7 +59,7 @@ func printLilyTerm(colors []color.Color) string {
 func printTermite(colors []color.Color) string {
 	output := ""
 	for i, c := range colors {
-		cc := c.(color.NRGBA)
+		cc := nrgba(c)
 		bytes := []byte{byte(cc.R), byte(cc.G), byte(cc.B)}
 		output += "color"
 		output += strconv.Itoa(i)
@@ -49,13 +68,17 @@ func printTermite(colors []color.Color) string {
 		output += hex.EncodeToString(bytes)
 		output += "\n"
 	}
+	if alpha := backgroundOpacity(colors); alpha < 1 {
+		bg := nrgba(colors[backgroundSlot])
+		output += fmt.Sprintf("background = rgba(%d, %d, %d, %v)\n", bg.R, bg.G, bg.B, formatOpacity(alpha))
+	}
 	return output
 }
 
 func printTerminator(colors []color.Color) string {
 	output := "palette = \""
 	for i, c := range colors {
-		cc := c.(color.NRGBA)
+		cc := nrgba(c)
 		bytes := []byte{byte(cc.R), byte(cc.G), byte(cc.B)}
 		if i < len(colors)-1 {
 			output += "#"
@@ -75,7 +98,7 @@ func printXterm(colors []color.Color) string {
 	output += "! Terminal colors"
 	output += "\n"
 	for i, c := range colors {
-		cc := c.(color.NRGBA)
+		cc := nrgba(c)
 		bytes := []byte{byte(cc.R), byte(cc.G), byte(cc.B)}
 		output += "*color"
 		output += strconv.Itoa(i)
@@ -90,7 +113,7 @@ func printXterm(colors []color.Color) string {
 func printKonsole(colors []color.Color) string {
 	output := ""
 	for i, c := range colors {
-		cc := c.(color.NRGBA)
+		cc := nrgba(c)
 		output += "[Color"
 		if i > 7 {
 			output += strconv.Itoa(i - 8)
@@ -105,6 +128,10 @@ func printKonsole(colors []color.Color) string {
 		output += strconv.Itoa(int(cc.B)) + "\n"
 		output += "Transparency=false\n\n"
 	}
+	if alpha := backgroundOpacity(colors); alpha < 1 {
+		output += "[General]\n"
+		output += "Opacity=" + formatOpacity(alpha) + "\n"
+	}
 
 	return output
 }
@@ -114,7 +141,7 @@ func printRoxTerm(colors []color.Color) string {
 	output += "pallete_size=16\n"
 
 	for i, c := range colors {
-		cc := c.(color.NRGBA)
+		cc := nrgba(c)
 		bytes := []byte{byte(cc.R), byte(cc.G), byte(cc.B)}
 		output += "color"
 		output += strconv.Itoa(i)
@@ -133,25 +160,40 @@ func printITerm2(colors []color.Color) string {
 	output += "<plist version=\"1.0\">\n"
 	output += "<dict>\n"
 	for i, c := range colors {
-		cc := c.(color.NRGBA)
+		cc := nrgba64(c)
 		output += "\t<key>Ansi "
 		output += strconv.Itoa(i)
 		output += " Color</key>\n"
 		output += "\t<dict>\n"
 		output += "\t\t<key>Blue Component</key>\n"
 		output += "\t\t<real>"
-		output += strconv.FormatFloat(float64(cc.B)/255, 'f', 17, 64)
+		output += strconv.FormatFloat(float64(cc.B)/0xffff, 'f', 17, 64)
 		output += "</real>\n"
 		output += "\t\t<key>Green Component</key>\n"
 		output += "\t\t<real>"
-		output += strconv.FormatFloat(float64(cc.G)/255, 'f', 17, 64)
+		output += strconv.FormatFloat(float64(cc.G)/0xffff, 'f', 17, 64)
 		output += "</real>\n"
 		output += "\t\t<key>Red Component</key>\n"
 		output += "\t\t<real>"
-		output += strconv.FormatFloat(float64(cc.R)/255, 'f', 17, 64)
+		output += strconv.FormatFloat(float64(cc.R)/0xffff, 'f', 17, 64)
 		output += "</real>\n"
 		output += "\t</dict>\n"
 	}
+	if alpha := backgroundOpacity(colors); alpha < 1 {
+		// iTerm2 takes the transparency of the background from its alpha
+		bg := nrgba64(colors[backgroundSlot])
+		output += "\t<key>Background Color</key>\n"
+		output += "\t<dict>\n"
+		output += "\t\t<key>Alpha Component</key>\n"
+		output += "\t\t<real>" + formatOpacity(alpha) + "</real>\n"
+		output += "\t\t<key>Blue Component</key>\n"
+		output += "\t\t<real>" + strconv.FormatFloat(float64(bg.B)/0xffff, 'f', 17, 64) + "</real>\n"
+		output += "\t\t<key>Green Component</key>\n"
+		output += "\t\t<real>" + strconv.FormatFloat(float64(bg.G)/0xffff, 'f', 17, 64) + "</real>\n"
+		output += "\t\t<key>Red Component</key>\n"
+		output += "\t\t<real>" + strconv.FormatFloat(float64(bg.R)/0xffff, 'f', 17, 64) + "</real>\n"
+		output += "\t</dict>\n"
+	}
 	output += "</dict>\n"
 	output += "</plist>\n"
 	return output
@@ -160,7 +202,7 @@ func printITerm2(colors []color.Color) string {
 func printURxvt(colors []color.Color) string {
 	output := ""
 	for i, c := range colors {
-		cc := c.(color.NRGBA)
+		cc := nrgba(c)
 		bytes := []byte{byte(cc.R), byte(cc.G), byte(cc.B)}
 		output += "URxvt*color"
 		output += strconv.Itoa(i)
@@ -169,13 +211,19 @@ func printURxvt(colors []color.Color) string {
 		output += hex.EncodeToString(bytes)
 		output += "\n"
 	}
+	if alpha := backgroundOpacity(colors); alpha < 1 {
+		// urxvt needs a 32-bit visual for a background with an alpha percentage
+		bg := nrgba(colors[backgroundSlot])
+		output += "URxvt*depth: 32\n"
+		output += fmt.Sprintf("URxvt*background: [%d]#%02x%02x%02x\n", int(alpha*100+0.5), bg.R, bg.G, bg.B)
+	}
 	return output
 }
 
 func printColors(colors []color.Color) string {
 	output := ""
 	for _, c := range colors {
-		cc := c.(color.NRGBA)
+		cc := nrgba(c)
 		bytes := []byte{byte(cc.R), byte(cc.G), byte(cc.B)}
 		output += "#"
 		output += hex.EncodeToString(bytes)
@@ -186,7 +234,7 @@ func printColors(colors []color.Color) string {
 func printChrome(colors []color.Color) string {
 	output := "{"
 	for i, c := range colors {
-		cc := c.(color.NRGBA)
+		cc := nrgba(c)
 		bytes := []byte{byte(cc.R), byte(cc.G), byte(cc.B)}
 		output += " \""
 		output += strconv.Itoa(i)
@@ -225,7 +273,7 @@ func printOSXTerminal(colors []color.Color) string {
 	output += "<plist version=\"1.0\">\n"
 	output += "<dict>\n"
 	for i, c := range colors {
-		cc := c.(color.NRGBA)
+		cc := nrgba64(c)
 		output += "\t<key>ANSI"
 		if i > 7 {
 			output += "Bright" + OSXColorNames[i-8]
@@ -234,7 +282,7 @@ func printOSXTerminal(colors []color.Color) string {
 		}
 		output += "Color</key>\n"
 		output += "\t<data>\n"
-		rgbColorString := fmt.Sprintf("%.10f %.10f %.10f", float64(cc.R)/255, float64(cc.G)/255, float64(cc.B)/255)
+		rgbColorString := fmt.Sprintf("%.10f %.10f %.10f", float64(cc.R)/0xffff, float64(cc.G)/0xffff, float64(cc.B)/0xffff)
 		serializedColor := fmt.Sprintf(OSXSerializedNSColorTemplate, base64.StdEncoding.EncodeToString([]byte(rgbColorString)))
 		output += "\t" + base64.StdEncoding.EncodeToString([]byte(serializedColor))
 		output += "\n\t</data>\n"
@@ -250,7 +298,7 @@ func printOSXTerminal(colors []color.Color) string {
 func printGnomeDConf(colors []color.Color) string {
 	output := "#!/usr/bin/env bash\npalette=\"["
 	for i, c := range colors {
-		cc := c.(color.NRGBA)
+		cc := nrgba(c)
 		bytes := []byte{byte(cc.R), byte(cc.G), byte(cc.B)}
 		output += "'"
 		output += "#"
@@ -266,13 +314,17 @@ func printGnomeDConf(colors []color.Color) string {
 	output += "\n"
 	output += "dconf write /org/gnome/terminal/legacy/profiles:/:$default/palette \"$palette\""
 	output += "\n"
+	if alpha := backgroundOpacity(colors); alpha < 1 {
+		output += "dconf write /org/gnome/terminal/legacy/profiles:/:$default/use-transparent-background true\n"
+		output += "dconf write /org/gnome/terminal/legacy/profiles:/:$default/background-transparency-percent " + strconv.Itoa(int((1-alpha)*100+0.5)) + "\n"
+	}
 	return output
 }
 
 func printKittyTerm(colors []color.Color) string {
 	output := ""
 	for i, c := range colors {
-		cc := c.(color.NRGBA)
+		cc := nrgba(c)
 		bytes := []byte{byte(cc.R), byte(cc.G), byte(cc.B)}
 		output += "color"
 		output += strconv.Itoa(i)
@@ -280,6 +332,9 @@ func printKittyTerm(colors []color.Color) string {
 		output += hex.EncodeToString(bytes)
 		output += "\n"
 	}
+	if alpha := backgroundOpacity(colors); alpha < 1 {
+		output += "background_opacity\t" + formatOpacity(alpha) + "\n"
+	}
 
 	return output
 }
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+var overlayGravities = [...]string{"center", "top-left", "top", "top-right", "left", "right", "bottom-left", "bottom", "bottom-right"}
+
+// overlayPlacement returns where the overlay is drawn within area, given
+// the overlay's size in pixels and the height of the whole canvas.
+func overlayPlacement(area image.Rectangle, size image.Point, canvasHeight int) (image.Rectangle, error) {
+	w, h := size.X, size.Y
+	if *overlayScale > 0 && h > 0 {
+		// Scale is a percentage of the canvas height, keeping the aspect ratio
+		h = canvasHeight * *overlayScale / 100
+		w = int(math.Round(float64(size.X) * float64(h) / float64(size.Y)))
+	}
+
+	margin := *overlayMargin
+	left := area.Min.X + margin
+	right := area.Max.X - margin - w
+	top := area.Min.Y + margin
+	bottom := area.Max.Y - margin - h
+	centerX := area.Min.X + (area.Dx()-w)/2
+	centerY := area.Min.Y + (area.Dy()-h)/2
+
+	var x, y int
+	switch *overlayGravity {
+	case "center":
+		x, y = centerX, centerY
+	case "top-left":
+		x, y = left, top
+	case "top":
+		x, y = centerX, top
+	case "top-right":
+		x, y = right, top
+	case "left":
+		x, y = left, centerY
+	case "right":
+		x, y = right, centerY
+	case "bottom-left":
+		x, y = left, bottom
+	case "bottom":
+		x, y = centerX, bottom
+	case "bottom-right":
+		x, y = right, bottom
+	default:
+		return image.Rectangle{}, errors.New("Unrecognised overlay gravity: " + *overlayGravity)
+	}
+	return image.Rect(x, y, x+w, y+h), nil
+}
+
+// recolorOverlay paints every pixel of the overlay with the palette color
+// selected by -overlayColor, keeping the overlay's alpha.
+// Useful for tinting monochrome logos to match the scheme.
+func recolorOverlay(overlay image.Image, palette []color.Color) (image.Image, error) {
+	if *overlayColor < 0 {
+		return overlay, nil
+	}
+	if *overlayColor >= len(palette) {
+		return nil, errors.New("Overlay color must be a palette slot between 0 and 15")
+	}
+	tint := nrgba(palette[*overlayColor])
+
+	bounds := overlay.Bounds()
+	img := image.NewNRGBA(bounds)
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			a := nrgba(overlay.At(x, y)).A
+			img.SetNRGBA(x, y, color.NRGBA{tint.R, tint.G, tint.B, a})
+		}
+	}
+	return img, nil
+}
+
+// scaleImage resizes src to w*h pixels with bilinear filtering
+func scaleImage(src image.Image, w int, h int) image.Image {
+	bounds := src.Bounds()
+	if bounds.Dx() == w && bounds.Dy() == h {
+		return src
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	if w <= 0 || h <= 0 {
+		return img
+	}
+	// Sample with premultiplied alpha so transparent edges don't darken
+	at := func(x, y int) [4]float64 {
+		x = bounds.Min.X + int(math.Max(0, math.Min(float64(x), float64(bounds.Dx()-1))))
+		y = bounds.Min.Y + int(math.Max(0, math.Min(float64(y), float64(bounds.Dy()-1))))
+		r, g, b, a := src.At(x, y).RGBA()
+		return [4]float64{float64(r), float64(g), float64(b), float64(a)}
+	}
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			sx := (float64(x)+0.5)*float64(bounds.Dx())/float64(w) - 0.5
+			sy := (float64(y)+0.5)*float64(bounds.Dy())/float64(h) - 0.5
+			x0, y0 := int(math.Floor(sx)), int(math.Floor(sy))
+			fx, fy := sx-float64(x0), sy-float64(y0)
+			c00, c10, c01, c11 := at(x0, y0), at(x0+1, y0), at(x0, y0+1), at(x0+1, y0+1)
+			var c [4]uint16
+			for i := range c {
+				top := c00[i]*(1-fx) + c10[i]*fx
+				bottom := c01[i]*(1-fx) + c11[i]*fx
+				c[i] = uint16(math.Round(top*(1-fy) + bottom*fy))
+			}
+			img.Set(x, y, color.RGBA64{c[0], c[1], c[2], c[3]})
+		}
+	}
+	return img
+}
+
+// overlayImage draws front on top of back, scaled to fill dst,
+// at the opacity given by -overlayOpacity.
+func overlayImage(back image.Image, front image.Image, dst image.Rectangle) image.Image {
+	img := image.NewNRGBA(back.Bounds())
+	draw.Draw(img, img.Bounds(), back, back.Bounds().Min, draw.Src)
+	front = scaleImage(front, dst.Dx(), dst.Dy())
+	mask := image.NewUniform(color.Alpha{uint8(capToMax(*overlayOpacity, 100) * 255 / 100)})
+	draw.DrawMask(img, dst, front, front.Bounds().Min, mask, image.Point{0, 0}, draw.Over)
+	return img
+}
+
+// applyOverlay draws the overlay image, if any, on top of a rendered image
+func applyOverlay(img image.Image, palette []color.Color) (image.Image, error) {
+	if *imageOverlay == "" {
+		return img, nil
+	}
+	overlay, err := loadImage(*imageOverlay)
+	if err != nil {
+		return nil, err
+	}
+	overlay, err = recolorOverlay(overlay, palette)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := overlayPlacement(overlayArea(img.Bounds()), overlay.Bounds().Size(), img.Bounds().Dy())
+	if err != nil {
+		return nil, err
+	}
+	return overlayImage(img, overlay, dst), nil
+}
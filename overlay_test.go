@@ -0,0 +1,111 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// setOverlayOptions sets the overlay placement options for a test, putting
+// them back afterwards
+func setOverlayOptions(t *testing.T, gravity string, margin int, scale int) {
+	registerDefaults()
+	savedGravity, savedMargin, savedScale := *overlayGravity, *overlayMargin, *overlayScale
+	t.Cleanup(func() {
+		*overlayGravity, *overlayMargin, *overlayScale = savedGravity, savedMargin, savedScale
+	})
+	*overlayGravity, *overlayMargin, *overlayScale = gravity, margin, scale
+}
+
+func TestOverlayPlacement(t *testing.T) {
+	area := image.Rect(0, 0, 1000, 500)
+	size := image.Pt(100, 50)
+	for _, test := range []struct {
+		gravity  string
+		margin   int
+		scale    int
+		expected image.Rectangle
+	}{
+		{"center", 0, 0, image.Rect(450, 225, 550, 275)},
+		{"top-left", 0, 0, image.Rect(0, 0, 100, 50)},
+		{"top", 10, 0, image.Rect(450, 10, 550, 60)},
+		{"top-right", 10, 0, image.Rect(890, 10, 990, 60)},
+		{"left", 20, 0, image.Rect(20, 225, 120, 275)},
+		{"right", 20, 0, image.Rect(880, 225, 980, 275)},
+		{"bottom-left", 0, 0, image.Rect(0, 450, 100, 500)},
+		{"bottom", 30, 0, image.Rect(450, 420, 550, 470)},
+		{"bottom-right", 30, 0, image.Rect(870, 420, 970, 470)},
+		// Scaled to 20% of the canvas height, keeping the aspect ratio
+		{"center", 0, 20, image.Rect(400, 200, 600, 300)},
+		{"bottom-right", 10, 20, image.Rect(790, 390, 990, 490)},
+	} {
+		setOverlayOptions(t, test.gravity, test.margin, test.scale)
+		got, err := overlayPlacement(area, size, 500)
+		if err != nil {
+			t.Errorf("%v: %v", test.gravity, err)
+		} else if got != test.expected {
+			t.Errorf("%v with margin %v and scale %v placed at %v, expected %v", test.gravity, test.margin, test.scale, got, test.expected)
+		}
+	}
+
+	// Within a monitor that isn't at the origin, and scaled by the height of
+	// the whole canvas
+	setOverlayOptions(t, "top-left", 5, 10)
+	got, _ := overlayPlacement(image.Rect(1920, 0, 3840, 1080), size, 1080)
+	if expected := image.Rect(1925, 5, 2141, 113); got != expected {
+		t.Errorf("Placed on the second monitor at %v, expected %v", got, expected)
+	}
+
+	setOverlayOptions(t, "middle", 0, 0)
+	if _, err := overlayPlacement(area, size, 500); err == nil {
+		t.Error("Expected an error for an unknown gravity")
+	}
+}
+
+// TestOverlayImageCoversPlacement checks that the overlay fills exactly the
+// rectangle it is placed in, down to its bottom edge.
+func TestOverlayImageCoversPlacement(t *testing.T) {
+	registerDefaults()
+	back := image.NewNRGBA(image.Rect(0, 0, 100, 100))
+	draw.Draw(back, back.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	front := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+	draw.Draw(front, front.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	dst := image.Rect(30, 40, 70, 60)
+	img := overlayImage(back, front, dst)
+	for x := 0; x < 100; x++ {
+		for y := 0; y < 100; y++ {
+			expected := color.NRGBA{0, 0, 0, 255}
+			if image.Pt(x, y).In(dst) {
+				expected = color.NRGBA{255, 255, 255, 255}
+			}
+			if got := nrgba(img.At(x, y)); got != expected {
+				t.Fatalf("Pixel %v,%v is %v, expected %v", x, y, got, expected)
+			}
+		}
+	}
+}
+
+func TestValidateOverlayOptions(t *testing.T) {
+	registerDefaults()
+	savedOpacity, savedScale := *overlayOpacity, *overlayScale
+	t.Cleanup(func() { *overlayOpacity, *overlayScale = savedOpacity, savedScale })
+
+	for _, test := range []struct {
+		opacity, scale int
+		valid          bool
+	}{
+		{100, 0, true},
+		{0, 15, true},
+		{50, 100, true},
+		{-10, 0, false},
+		{101, 0, false},
+		{100, -5, false},
+	} {
+		*overlayOpacity, *overlayScale = test.opacity, test.scale
+		if err := validateOptions(); (err == nil) != test.valid {
+			t.Errorf("Opacity %v and scale %v gave %v", test.opacity, test.scale, err)
+		}
+	}
+}
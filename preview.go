@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+)
+
+// Names of the 8 standard terminal colors, brighter versions follow them
+var slotNames = [...]string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+
+// Width of each swatch in the preview, in characters
+const previewSwatchWidth = 11
+
+// Width of the sample terminal in the preview, in characters
+const previewSampleWidth = 64
+
+// slotName returns the usual name of a palette slot, Eg. "red" or "bright red"
+func slotName(slot int) string {
+	if slot >= 8 {
+		return "bright " + slotNames[slot%8]
+	}
+	return slotNames[slot]
+}
+
+// trueColor returns the escape sequence to set the 24-bit foreground (38) or background (48) color
+func trueColor(layer int, c color.Color) string {
+	cc := nrgba(c)
+	return fmt.Sprintf("\033[%d;2;%d;%d;%dm", layer, cc.R, cc.G, cc.B)
+}
+
+// A previewSpan is text in the sample terminal, drawn with a palette slot,
+// or the foreground color if slot is -1.
+type previewSpan struct {
+	slot int
+	text string
+}
+
+// Lines of sample text, to show how readable the scheme is: a directory
+// listing, a diff, and compiler errors.
+var previewSamples = [][]previewSpan{
+	{{2, "user@host"}, {-1, ":"}, {4, "~/src/schemer2"}, {-1, "$ ls -l"}},
+	{{-1, "drwxr-xr-x 2 user user  4096 Oct 18 12:00 "}, {12, "docs/"}},
+	{{-1, "-rwxr-xr-x 1 user user 81920 Oct 18 12:00 "}, {10, "schemer2"}},
+	{{-1, "-rw-r--r-- 1 user user  2143 Oct 18 12:00 README.md"}},
+	{{-1, "lrwxrwxrwx 1 user user    10 Oct 18 12:00 "}, {14, "latest"}, {-1, " -> "}, {12, "docs/"}},
+	{{-1, "-rw-r--r-- 1 user user 40960 Oct 18 12:00 "}, {9, "release.tar.gz"}},
+	{{-1, "-rw-r--r-- 1 user user 18432 Oct 18 12:00 "}, {13, "wallpaper.png"}},
+	{{2, "user@host"}, {-1, ":"}, {4, "~/src/schemer2"}, {-1, "$ git diff"}},
+	{{15, "diff --git a/main.go b/main.go"}},
+	{{6, "@@ -10,7 +10,7 @@"}, {-1, " func main() {"}},
+	{{-1, " \tflag.Parse()"}},
+	{{1, "-\tfmt.Println(\"hello\")"}},
+	{{2, "+\tfmt.Println(\"hello, world\")"}},
+	{{2, "user@host"}, {-1, ":"}, {4, "~/src/schemer2"}, {-1, "$ go build"}},
+	{{15, "./main.go:12:5: "}, {9, "error:"}, {-1, " undefined: colours"}},
+	{{15, "./main.go:20:2: "}, {11, "warning:"}, {-1, " unused variable 'w'"}},
+	{{15, "./main.go:20:2: "}, {14, "note:"}, {-1, " declared here"}},
+	{{8, "# comments and other dim text use color 8"}},
+}
+
+// previewSwatches draws the palette as two rows of colored blocks, normal
+// colors then bright colors, labeled with the slot and hex value of each color.
+func previewSwatches(colors []color.Color) string {
+	output := ""
+	for row := 0; row < len(colors); row += 8 {
+		if row == 0 {
+			output += "Normal colors\n"
+		} else {
+			output += "Bright colors\n"
+		}
+		end := row + 8
+		if end > len(colors) {
+			end = len(colors)
+		}
+		labels, blocks, hexes := "", "", ""
+		for i := row; i < end; i++ {
+			labels += fmt.Sprintf("%-*v", previewSwatchWidth, fmt.Sprintf("%d %v", i, slotNames[i%8]))
+			blocks += trueColor(48, colors[i]) + strings.Repeat(" ", previewSwatchWidth-2) + "\033[0m  "
+			hexes += fmt.Sprintf("%-*v", previewSwatchWidth, svgColor(colors[i]))
+		}
+		output += labels + "\n" + blocks + "\n" + blocks + "\n" + hexes + "\n\n"
+	}
+	return output
+}
+
+// previewSample draws the sample text with the scheme's foreground and background
+func previewSample(colors []color.Color) string {
+	background := trueColor(48, colors[backgroundSlot])
+	foreground := trueColor(38, colors[foregroundSlot])
+	blank := background + strings.Repeat(" ", previewSampleWidth) + "\033[0m\n"
+
+	output := blank
+	for _, line := range previewSamples {
+		output += background + " "
+		width := 1
+		for _, span := range line {
+			if span.slot < 0 {
+				output += foreground
+			} else {
+				output += trueColor(38, colors[span.slot])
+			}
+			text := strings.Replace(span.text, "\t", "    ", -1)
+			output += text
+			width += len(text)
+		}
+		if width < previewSampleWidth {
+			output += strings.Repeat(" ", previewSampleWidth-width)
+		}
+		output += "\033[0m\n"
+	}
+	return output + blank
+}
+
+// printPreview shows the scheme in a terminal that supports 24-bit color,
+// without changing the terminal's own colors.
+func printPreview(colors []color.Color) string {
+	return previewSwatches(colors) + previewSample(colors)
+}
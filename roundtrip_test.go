@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Formats that are read from a file rather than an image or the terminal,
+// and so can be checked with generated files
+func textReaders() []Format {
+	readers := make([]Format, 0)
+	for _, f := range formats {
+		if f.input != nil && f.flagName != "img" && f.flagName != "live" {
+			readers = append(readers, f)
+		}
+	}
+	return readers
+}
+
+// randomScheme returns 16 random opaque colors, with 16 bits per channel
+func randomScheme(r *rand.Rand) []color.Color {
+	colors := make([]color.Color, 16)
+	for i := range colors {
+		colors[i] = color.NRGBA64{uint16(r.Intn(0x10000)), uint16(r.Intn(0x10000)), uint16(r.Intn(0x10000)), 0xffff}
+	}
+	return colors
+}
+
+// readText reads colors from text with a format's reader, through filename
+func readText(t testing.TB, f Format, filename string, text string) ([]color.Color, error) {
+	err := ioutil.WriteFile(filename, []byte(text), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f.input(filename)
+}
+
+// Formats that keep 16 bits per channel. Others keep 8.
+var sixteenBitFormats = map[string]bool{"xfce": true}
+
+// hasBackgroundOpacity reports whether a format reads and writes the opacity
+// of the background
+func hasBackgroundOpacity(f Format) bool {
+	for _, special := range f.specialColors {
+		if special == "background opacity" {
+			return true
+		}
+	}
+	return false
+}
+
+// translucentScheme gives a scheme a random background opacity, in the
+// steps of 1% that formats write it in
+func translucentScheme(r *rand.Rand, colors []color.Color) []color.Color {
+	colors[backgroundSlot] = withOpacity(colors[backgroundSlot], float64(r.Intn(101))/100)
+	return colors
+}
+
+// sameColors compares colors with the precision a format keeps, including
+// their alpha
+func sameColors(f Format, a []color.Color, b []color.Color) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if sixteenBitFormats[f.flagName] && nrgba64(a[i]) != nrgba64(b[i]) {
+			return false
+		}
+		if nrgba(a[i]) != nrgba(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// describeColors lists colors with all 16 bits of each channel, and alpha
+func describeColors(colors []color.Color) string {
+	described := make([]string, len(colors))
+	for i, c := range colors {
+		cc := nrgba64(c)
+		described[i] = fmt.Sprintf("#%04x%04x%04x/%04x", cc.R, cc.G, cc.B, cc.A)
+	}
+	return strings.Join(described, " ")
+}
+
+// TestRoundTrip writes random schemes with each format that can also read
+// them, and checks that reading them back gives the same colors, to the
+// precision the format keeps, and the same background opacity for formats
+// that have one.
+func TestRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, f := range textReaders() {
+		if f.output == nil {
+			continue
+		}
+		t.Run(f.flagName, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "scheme")
+			for i := 0; i < 100; i++ {
+				colors := randomScheme(r)
+				if hasBackgroundOpacity(f) {
+					colors = translucentScheme(r, colors)
+				}
+				got, err := readText(t, f, filename, f.output(colors))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !sameColors(f, colors, got) {
+					t.Fatalf("Wrote %v\nbut read %v", describeColors(colors), describeColors(got))
+				}
+			}
+		})
+	}
+}
+
+// Pieces of config files to insert when damaging files
+var fuzzFragments = []string{"", " ", "\n", "#", "=", ":", ";", "\"", "color", "Color", "*color", "palette", "ColorPalette", "[colors]", "\t", "#fff", "#ffffffffffff", "99", "-1", "\x00", "é"}
+
+// damage makes a random change to text: cutting it short, deleting or
+// repeating part of it, or inserting a fragment of config.
+func damage(r *rand.Rand, text string) string {
+	if text == "" {
+		return fuzzFragments[r.Intn(len(fuzzFragments))]
+	}
+	i := r.Intn(len(text))
+	j := i + r.Intn(len(text)-i)
+	switch r.Intn(5) {
+	case 0:
+		return text[:i]
+	case 1:
+		return text[:i] + text[j:]
+	case 2:
+		return text[:j] + text[i:]
+	case 3:
+		return text[:i] + string(rune(r.Intn(128))) + text[i+1:]
+	}
+	return text[:i] + fuzzFragments[r.Intn(len(fuzzFragments))] + text[i:]
+}
+
+func FuzzParseColor(f *testing.F) {
+	for _, seed := range []string{
+		"#fff", "#ffff", "#cc6666", "#cc666680", "#123456789", "#123456789abc",
+		"rgb:1/22/333", "rgb:1234/5678/9abc", "rgbi:0.5/1/0",
+		"rgb(255, 0, 0)", "rgba(255 0 0 / 50%)", "hsl(120deg 50% 50%)", "hsla(-90, 100%, 25%, 0.5)",
+		"Dark Slate Gray", "rebeccapurple", "transparent",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, c string) {
+		parseColor(c)
+	})
+}
+
+// Formats with a FuzzReader function below
+var fuzzedReaders = []string{"xfce", "lilyterm", "termite", "terminator", "xterm", "urxvt", "kitty"}
+
+// fuzzReader feeds damaged files to a format's reader, to check that it
+// doesn't crash. The seed corpus is files written by the format, or by xterm
+// for formats that can't be written, and damaged copies of them.
+func fuzzReader(f *testing.F, name string) {
+	format, _ := findFormat(name)
+	writer := format
+	if writer.output == nil {
+		writer, _ = findFormat("xterm")
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 50; i++ {
+		text := writer.output(randomScheme(r))
+		for n := r.Intn(4); n > 0; n-- {
+			text = damage(r, text)
+		}
+		f.Add(text)
+	}
+	filename := filepath.Join(f.TempDir(), "scheme")
+	f.Fuzz(func(t *testing.T, text string) {
+		readText(t, format, filename, text)
+	})
+}
+
+func FuzzReaderXfce(f *testing.F)       { fuzzReader(f, "xfce") }
+func FuzzReaderLilyTerm(f *testing.F)   { fuzzReader(f, "lilyterm") }
+func FuzzReaderTermite(f *testing.F)    { fuzzReader(f, "termite") }
+func FuzzReaderTerminator(f *testing.F) { fuzzReader(f, "terminator") }
+func FuzzReaderXterm(f *testing.F)      { fuzzReader(f, "xterm") }
+func FuzzReaderURxvt(f *testing.F)      { fuzzReader(f, "urxvt") }
+func FuzzReaderKitty(f *testing.F)      { fuzzReader(f, "kitty") }
+
+// TestEveryReaderFuzzed checks that a reader added to formats is given a
+// FuzzReader function.
+func TestEveryReaderFuzzed(t *testing.T) {
+	readers := make([]string, 0)
+	for _, f := range textReaders() {
+		readers = append(readers, f.flagName)
+	}
+	fuzzed := append([]string{}, fuzzedReaders...)
+	sort.Strings(readers)
+	sort.Strings(fuzzed)
+	if fmt.Sprint(readers) != fmt.Sprint(fuzzed) {
+		t.Errorf("Readers are %v, but FuzzReader functions are for %v", readers, fuzzed)
+	}
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"errors"
+	"image/color"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Height that scenes are laid out at. Sizes given on the command line are
+// in pixels at this height, and are scaled to the height being rendered,
+// so the same seed gives the same layout at any resolution.
+const sceneHeight = 1080
+
+// Random source for generating scenes
+var rng *rand.Rand
+
+// A Scene is a resolution independent description of a generated image,
+// produced by the generators and drawn by the render function of an image format.
+type Scene struct {
+	width, height float64
+	background    color.Color
+	palette       []color.Color
+	shapes        []Shape // Drawn in order, back to front
+}
+
+// A Shape is anything that can be drawn in a scene.
+type Shape interface {
+	// fill returns the color of the shape
+	fill() color.Color
+	// alpha returns the opacity (0-1) of the shape at a point in the scene
+	alpha(x, y float64) float64
+	// bounds returns the area of the scene the shape may cover
+	bounds(s Scene) (minX, minY, maxX, maxY float64)
+}
+
+// A uniformShape can tell when an area is wholly inside or outside it, or
+// otherwise has the same alpha all over, so that pixels away from its edges
+// needn't be sampled more than once.
+type uniformShape interface {
+	uniform(minX, minY, maxX, maxY float64) bool
+}
+
+type renderFunction (func(s Scene, w int, h int, out io.Writer) error)
+
+// newScene lays out a scene with the aspect ratio of w*h, using the image
+// output options.
+func newScene(colors []color.Color, w int, h int) (Scene, error) {
+	seed := *imageSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rng = rand.New(rand.NewSource(seed))
+
+	s := Scene{
+		width:      sceneHeight * float64(w) / float64(h),
+		height:     sceneHeight,
+		background: colors[0],
+		palette:    colors,
+	}
+
+	outType := *imageOutType
+	if outType == "random" {
+		outType = randomiseImageOptions(int(s.width), int(s.height))
+	}
+
+	switch outType {
+	case "circles":
+		s.shapes = Circles(colors, s.width, s.height, *circlesSize, *circlesSizeVariance, *circlesOverlap, *circlesDrawLargestToSmallest, *circlesFilled, *circlesBorderSize, *circlesBlur, *circlesOpacity)
+	case "rays":
+		s.shapes = Rays(colors, s.width, s.height, *raysSize, *raysSizeVariance, *raysDistributeEvenly, *raysCentered, *raysDrawLargestToSmallest)
+	case "stripes":
+		s.shapes = Lines(colors, s.width, s.height, *stripesSize, *stripesSizeVariance, *stripesHorizontal, *stripesEvenSpacing, *stripesSpacing, *stripesOffset)
+	default:
+		return s, errors.New("Unrecognised ouput image type: " + outType + "\n")
+	}
+	return s, nil
+}
+
+// randomiseImageOptions sets random options for a randomly chosen
+// image type, and returns that type.
+func randomiseImageOptions(w int, h int) string {
+	switch rng.Intn(3) {
+	case 0:
+		*circlesSize = rng.Intn(w / 2)
+		*circlesSizeVariance = rng.Intn(w / 2)
+		*circlesOverlap = randBool()
+		*circlesDrawLargestToSmallest = randBool()
+		*circlesFilled = randBool()
+		*circlesBorderSize = rng.Intn(20)
+		*circlesBlur = randBool()
+		*circlesOpacity = 100
+		return "circles"
+	case 1:
+		*raysSize = rng.Intn(h/32) + 1
+		*raysSizeVariance = rng.Intn(h / 32)
+		*raysDistributeEvenly = randBool()
+		*raysCentered = true
+		*raysDrawLargestToSmallest = randBool()
+		return "rays"
+	default:
+		*stripesSize = rng.Intn(h/32) + 1
+		*stripesSizeVariance = rng.Intn(h / 32)
+		*stripesHorizontal = randBool()
+		*stripesEvenSpacing = randBool()
+		*stripesSpacing = rng.Intn(h / 32)
+		*stripesOffset = rng.Intn(h/2) + 1
+		return "stripes"
+	}
+}
+
+type Circle struct {
+	col     color.Color
+	x, y    float64
+	size    float64 // Radius
+	filled  bool
+	border  float64 // Width of the border when not filled
+	blur    bool
+	opacity float64
+}
+
+func (c Circle) fill() color.Color { return c.col }
+
+func (c Circle) bounds(s Scene) (float64, float64, float64, float64) {
+	return c.x - c.size, c.y - c.size, c.x + c.size, c.y + c.size
+}
+
+func (c Circle) alpha(x, y float64) float64 {
+	dist := math.Hypot(x-c.x, y-c.y)
+	if dist >= c.size {
+		return 0
+	}
+	if !c.filled && dist <= c.size-c.border {
+		return 0
+	}
+	if c.blur {
+		return 1 - dist/c.size
+	}
+	return c.opacity
+}
+
+func (c Circle) uniform(minX, minY, maxX, maxY float64) bool {
+	// Blurred circles fade all the way across
+	if c.blur {
+		return false
+	}
+	nearest := math.Hypot(math.Max(0, math.Max(minX-c.x, c.x-maxX)), math.Max(0, math.Max(minY-c.y, c.y-maxY)))
+	farthest := math.Hypot(math.Max(c.x-minX, maxX-c.x), math.Max(c.y-minY, maxY-c.y))
+	if nearest >= c.size {
+		return true
+	}
+	if c.filled {
+		return farthest < c.size
+	}
+	// Wholly inside the hole in the middle, or wholly on the border
+	inner := c.size - c.border
+	return farthest <= inner || (nearest > inner && farthest < c.size)
+}
+
+// For sorting circles by size
+type circleBySize []Circle
+
+func (a circleBySize) Len() int           { return len(a) }
+func (a circleBySize) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a circleBySize) Less(i, j int) bool { return a[i].size < a[j].size }
+
+func Circles(colors []color.Color, w float64, h float64, size int, sizevar int, overlap bool, large2small bool, filled bool, bordersize int, blur bool, opacity int) []Shape {
+	circles := make([]Circle, 0)
+	bg := colors[0]
+
+	for _, c := range colors {
+		// Do not create circle with background color
+		if c == bg {
+			continue
+		}
+		circle := Circle{
+			col:     c,
+			x:       rng.Float64() * w,
+			y:       rng.Float64() * h,
+			size:    float64(randMinMax(size-sizevar, size+sizevar)),
+			filled:  filled,
+			border:  float64(bordersize),
+			blur:    blur,
+			opacity: float64(opacity) / 100,
+		}
+		circles = append(circles, circle)
+	}
+
+	if large2small {
+		sort.Sort(sort.Reverse(circleBySize(circles)))
+	}
+
+	shapes := make([]Shape, 0, len(circles))
+	for _, c := range circles {
+		shapes = append(shapes, c)
+	}
+	return shapes
+}
+
+type Ray struct {
+	col   color.Color
+	x, y  float64 // Middle point
+	angle float64 // Degrees, clockwise from the positive x axis
+	size  float64 // Degrees either side of angle
+
+	// Direction of the ray, and the sine and cosine of its size, worked out
+	// once as alpha is run for every sample of the image
+	dx, dy, sinSize, cosSize float64
+}
+
+func newRay(col color.Color, x, y float64, angle float64, size float64) Ray {
+	return Ray{
+		col: col, x: x, y: y, angle: angle, size: size,
+		dx:      math.Cos(angle * math.Pi / 180),
+		dy:      math.Sin(angle * math.Pi / 180),
+		sinSize: math.Sin(size * math.Pi / 180),
+		cosSize: math.Cos(size * math.Pi / 180),
+	}
+}
+
+func (r Ray) fill() color.Color { return r.col }
+
+func (r Ray) bounds(s Scene) (float64, float64, float64, float64) {
+	return 0, 0, s.width, s.height
+}
+
+// A ray extends in both directions through its middle point. A point is in
+// it when the sine of its angle from the ray is less than the sine of the
+// ray's size, found with a cross product rather than an angle.
+func (r Ray) alpha(x, y float64) float64 {
+	if r.size >= 90 {
+		return 1
+	}
+	if r.size <= 0 {
+		return 0
+	}
+	vx, vy := x-r.x, y-r.y
+	cross := r.dx*vy - r.dy*vx
+	if cross*cross < r.sinSize*r.sinSize*(vx*vx+vy*vy) {
+		return 1
+	}
+	return 0
+}
+
+// An area is all in or all out of a ray when it is wholly on one side of
+// each of the ray's edges.
+func (r Ray) uniform(minX, minY, maxX, maxY float64) bool {
+	if r.size >= 90 || r.size <= 0 {
+		return true
+	}
+	corners := [4][2]float64{{minX, minY}, {maxX, minY}, {minX, maxY}, {maxX, maxY}}
+	// The directions of the edges, at angle-size and angle+size
+	edges := [2][2]float64{
+		{r.dx*r.cosSize + r.dy*r.sinSize, r.dy*r.cosSize - r.dx*r.sinSize},
+		{r.dx*r.cosSize - r.dy*r.sinSize, r.dy*r.cosSize + r.dx*r.sinSize},
+	}
+	for _, e := range edges {
+		positive, negative := false, false
+		for _, c := range corners {
+			side := e[0]*(c[1]-r.y) - e[1]*(c[0]-r.x)
+			positive = positive || side >= 0
+			negative = negative || side <= 0
+		}
+		if positive && negative {
+			return false
+		}
+	}
+	return true
+}
+
+// For sorting rays by size
+type rayBySize []Ray
+
+func (a rayBySize) Len() int           { return len(a) }
+func (a rayBySize) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a rayBySize) Less(i, j int) bool { return a[i].size < a[j].size }
+
+func Rays(colors []color.Color, w float64, h float64, size int, sizevar int, evendist bool, centered bool, large2small bool) []Shape {
+	rays := make([]Ray, 0)
+
+	spacing := 360 / len(colors)
+	current_angle := 0
+
+	xpos := w / 2
+	ypos := h / 2
+
+	bg := colors[0]
+
+	for _, c := range colors {
+		// Do not create ray with background color
+		if c == bg {
+			continue
+		}
+		if !centered {
+			xpos = rng.Float64() * w
+			ypos = rng.Float64() * h
+		}
+		if !evendist {
+			current_angle = rng.Intn(360)
+		}
+		ray := newRay(c, xpos, ypos, float64(current_angle), float64(randMinMax(size-sizevar, size+sizevar)))
+
+		if evendist {
+			current_angle += spacing + int(ray.size)
+		}
+		rays = append(rays, ray)
+	}
+
+	if large2small {
+		sort.Sort(sort.Reverse(rayBySize(rays)))
+	}
+
+	shapes := make([]Shape, 0, len(rays))
+	for _, r := range rays {
+		shapes = append(shapes, r)
+	}
+	return shapes
+}
+
+type Line struct {
+	col        color.Color
+	position   float64
+	size       float64
+	horizontal bool
+}
+
+func (l Line) fill() color.Color { return l.col }
+
+func (l Line) bounds(s Scene) (float64, float64, float64, float64) {
+	if l.horizontal {
+		return 0, l.position, s.width, l.position + l.size
+	}
+	return l.position, 0, l.position + l.size, s.height
+}
+
+func (l Line) alpha(x, y float64) float64 {
+	pos := x
+	if l.horizontal {
+		pos = y
+	}
+	if pos >= l.position && pos < l.position+l.size {
+		return 1
+	}
+	return 0
+}
+
+func (l Line) uniform(minX, minY, maxX, maxY float64) bool {
+	lo, hi := minX, maxX
+	if l.horizontal {
+		lo, hi = minY, maxY
+	}
+	return hi <= l.position || lo >= l.position+l.size || (lo >= l.position && hi <= l.position+l.size)
+}
+
+func Lines(colors []color.Color, w float64, h float64, size int, sizevar int, horizontal bool, equalspacing bool, spacingsize int, offset int) []Shape {
+	var maxsize float64
+	if horizontal {
+		maxsize = h
+	} else {
+		maxsize = w
+	}
+
+	currentposition := float64(offset)
+	spacing := float64(spacingsize)
+
+	shapes := make([]Shape, 0)
+	bg := colors[0]
+
+	for _, c := range colors {
+		// Do not create line with background color
+		if c == bg {
+			continue
+		}
+		line := Line{c, currentposition, float64(randMinMax(size-sizevar, size+sizevar)), horizontal}
+		shapes = append(shapes, line)
+		if !equalspacing {
+			spacing = float64(rng.Intn(int(maxsize) / 16))
+		}
+		currentposition += line.size + spacing
+	}
+	return shapes
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// TestUniformAreas checks that areas a shape calls uniform really have the
+// same alpha at every point that anti-aliasing samples.
+func TestUniformAreas(t *testing.T) {
+	shapes := []uniformShape{
+		newRay(color.White, 960, 540, 0, 5),
+		newRay(color.White, 100, 900, 30, 40),
+		newRay(color.White, 1800, 50, 200, 89),
+		newRay(color.White, 960, 540, 135, 120),
+		Line{color.White, 300.5, 40, false},
+		Line{color.White, 500, 0.3, true},
+		Circle{col: color.White, x: 960, y: 540, size: 200, filled: true, opacity: 1},
+		Circle{col: color.White, x: 100, y: 100, size: 50, border: 10, opacity: 0.5},
+	}
+	r := rand.New(rand.NewSource(1))
+	const aa = 4
+	for _, shape := range shapes {
+		for i := 0; i < 20000; i++ {
+			x, y := r.Float64()*1920, r.Float64()*1080
+			size := r.Float64() * 3
+			if !shape.uniform(x, y, x+size, y+size) {
+				continue
+			}
+			s := shape.(Shape)
+			first := s.alpha(x+size/(2*aa), y+size/(2*aa))
+			for sx := 0; sx < aa; sx++ {
+				for sy := 0; sy < aa; sy++ {
+					px := x + size*(float64(sx)+0.5)/aa
+					py := y + size*(float64(sy)+0.5)/aa
+					if a := s.alpha(px, py); a != first {
+						t.Fatalf("%+v is uniform over %v,%v +%v, but has alpha %v and %v", shape, x, y, size, first, a)
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestSceneResolutionIndependent checks that the same seed lays out the same
+// shapes at any resolution with the same aspect ratio, so that the images
+// only differ in size.
+func TestSceneResolutionIndependent(t *testing.T) {
+	t.Cleanup(func() { configFlagSet() })
+	colors := randomScheme(rand.New(rand.NewSource(1)))
+	for _, outType := range imageOutTypes {
+		for seed := int64(1); seed <= 5; seed++ {
+			// Reset the options a random layout changes
+			configFlagSet()
+			*imageOutType, *imageSeed = outType, seed
+			small, err := newScene(colors, 192, 108)
+			if err != nil {
+				t.Fatal(err)
+			}
+			configFlagSet()
+			*imageOutType, *imageSeed = outType, seed
+			large, err := newScene(colors, 384, 216)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(small, large) {
+				t.Errorf("%v with seed %v: scenes differ between 192x108 and 384x216", outType, seed)
+				continue
+			}
+
+			// Each pixel of the small image is close to the average of the
+			// four pixels it covers in the large one
+			smallImg := renderImage(small, 192, 108)
+			largeImg := renderImage(large, 384, 216)
+			far := 0
+			for x := 0; x < 192; x++ {
+				for y := 0; y < 108; y++ {
+					a := nrgba(smallImg.At(x, y))
+					var sum [3]int
+					for _, p := range []image.Point{{2 * x, 2 * y}, {2*x + 1, 2 * y}, {2 * x, 2*y + 1}, {2*x + 1, 2*y + 1}} {
+						b := nrgba(largeImg.At(p.X, p.Y))
+						sum[0], sum[1], sum[2] = sum[0]+int(b.R), sum[1]+int(b.G), sum[2]+int(b.B)
+					}
+					for i, v := range []uint8{a.R, a.G, a.B} {
+						if d := int(v) - sum[i]/4; d > 32 || d < -32 {
+							far++
+							break
+						}
+					}
+				}
+			}
+			if far > 192*108/100 {
+				t.Errorf("%v with seed %v: %d pixels differ between 192x108 and 384x216", outType, seed, far)
+			}
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+)
+
+func svgColor(c color.Color) string {
+	cc := nrgba(c)
+	bytes := []byte{byte(cc.R), byte(cc.G), byte(cc.B)}
+	return "#" + hex.EncodeToString(bytes)
+}
+
+func svgFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// renderSVG is the vector backend for scenes.
+// The scene is drawn in its own coordinates and scaled to w*h by the viewer.
+func renderSVG(s Scene, w int, h int, out io.Writer) error {
+	output := "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n"
+	output += "<svg xmlns=\"http://www.w3.org/2000/svg\" xmlns:xlink=\"http://www.w3.org/1999/xlink\" version=\"1.1\""
+	output += " width=\"" + strconv.Itoa(w) + "\" height=\"" + strconv.Itoa(h) + "\""
+	output += " viewBox=\"0 0 " + svgFloat(s.width) + " " + svgFloat(s.height) + "\">\n"
+	output += "\t<rect width=\"100%\" height=\"100%\" fill=\"" + svgColor(s.background) + "\"/>\n"
+
+	for i, shape := range s.shapes {
+		switch sh := shape.(type) {
+		case Circle:
+			output += svgCircle(sh, "blur"+strconv.Itoa(i))
+		case Ray:
+			output += svgRay(sh, s)
+		case Line:
+			output += svgLine(sh, s)
+		default:
+			return errors.New("Shape cannot be drawn as SVG")
+		}
+	}
+
+	if *imageOverlay != "" {
+		overlay, err := svgOverlay(s, w, h)
+		if err != nil {
+			return err
+		}
+		output += overlay
+	}
+
+	output += "</svg>\n"
+	_, err := io.WriteString(out, output)
+	return err
+}
+
+func svgCircle(c Circle, id string) string {
+	if c.size <= 0 {
+		return ""
+	}
+	output := ""
+	paint := svgColor(c.col)
+	if c.blur {
+		// Blurred circles fade from solid in the middle to transparent at the edge
+		output += "\t<defs>\n"
+		output += "\t\t<radialGradient id=\"" + id + "\" gradientUnits=\"userSpaceOnUse\""
+		output += " cx=\"" + svgFloat(c.x) + "\" cy=\"" + svgFloat(c.y) + "\" r=\"" + svgFloat(c.size) + "\">\n"
+		output += "\t\t\t<stop offset=\"0\" stop-color=\"" + paint + "\" stop-opacity=\"1\"/>\n"
+		output += "\t\t\t<stop offset=\"1\" stop-color=\"" + paint + "\" stop-opacity=\"0\"/>\n"
+		output += "\t\t</radialGradient>\n"
+		output += "\t</defs>\n"
+		paint = "url(#" + id + ")"
+	}
+
+	output += "\t<circle cx=\"" + svgFloat(c.x) + "\" cy=\"" + svgFloat(c.y) + "\""
+	if c.filled {
+		output += " r=\"" + svgFloat(c.size) + "\" fill=\"" + paint + "\""
+	} else {
+		// The stroke is centered on the radius, so move it inwards
+		// to keep the border inside the circle.
+		border := math.Min(c.border, c.size)
+		output += " r=\"" + svgFloat(c.size-border/2) + "\" fill=\"none\""
+		output += " stroke=\"" + paint + "\" stroke-width=\"" + svgFloat(border) + "\""
+	}
+	if !c.blur && c.opacity != 1 {
+		output += " opacity=\"" + svgFloat(c.opacity) + "\""
+	}
+	output += "/>\n"
+	return output
+}
+
+func svgRay(r Ray, s Scene) string {
+	if r.size <= 0 {
+		return ""
+	}
+	// A ray 90 degrees either side of its angle covers the whole scene
+	if r.size >= 90 {
+		return "\t<rect width=\"100%\" height=\"100%\" fill=\"" + svgColor(r.col) + "\"/>\n"
+	}
+	// Long enough to reach every corner of the scene from any middle point
+	length := math.Hypot(s.width, s.height)
+	// The far edge of each wedge is made of steps of at most 45 degrees, with
+	// their corners far enough out that the middle of each step reaches length
+	steps := int(math.Ceil(2 * r.size / 45))
+	step := 2 * r.size / float64(steps)
+	far := length / math.Cos(step/2*math.Pi/180)
+	output := "\t<path fill=\"" + svgColor(r.col) + "\" d=\""
+	// One wedge each side of the middle point
+	for _, direction := range []float64{0, 180} {
+		output += "M" + svgFloat(r.x) + "," + svgFloat(r.y)
+		for i := 0; i <= steps; i++ {
+			a := (r.angle + direction - r.size + float64(i)*step) * math.Pi / 180
+			output += " L" + svgFloat(r.x+far*math.Cos(a)) + "," + svgFloat(r.y+far*math.Sin(a))
+		}
+		output += " Z "
+	}
+	output += "\"/>\n"
+	return output
+}
+
+func svgLine(l Line, s Scene) string {
+	if l.size <= 0 {
+		return ""
+	}
+	minX, minY, maxX, maxY := l.bounds(s)
+	output := "\t<rect x=\"" + svgFloat(minX) + "\" y=\"" + svgFloat(minY) + "\""
+	output += " width=\"" + svgFloat(maxX-minX) + "\" height=\"" + svgFloat(maxY-minY) + "\""
+	output += " fill=\"" + svgColor(l.col) + "\"/>\n"
+	return output
+}
+
+// svgOverlay embeds the overlay image as a PNG, placed as it would be in
+// an image of w*h pixels.
+func svgOverlay(s Scene, w int, h int) (string, error) {
+	overlay, err := loadImage(*imageOverlay)
+	if err != nil {
+		return "", err
+	}
+	overlay, err = recolorOverlay(overlay, s.palette)
+	if err != nil {
+		return "", err
+	}
+	dst, err := overlayPlacement(overlayArea(image.Rect(0, 0, w, h)), overlay.Bounds().Size(), h)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = png.Encode(&buf, overlay)
+	if err != nil {
+		return "", err
+	}
+
+	// Pixels of the rendered image to scene coordinates
+	scale := s.height / float64(h)
+	output := "\t<image x=\"" + svgFloat(float64(dst.Min.X)*scale) + "\" y=\"" + svgFloat(float64(dst.Min.Y)*scale) + "\""
+	output += " width=\"" + svgFloat(float64(dst.Dx())*scale) + "\" height=\"" + svgFloat(float64(dst.Dy())*scale) + "\""
+	output += " preserveAspectRatio=\"none\""
+	if *overlayOpacity < 100 {
+		output += " opacity=\"" + svgFloat(float64(*overlayOpacity)/100) + "\""
+	}
+	output += " xlink:href=\"data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()) + "\"/>\n"
+	return output, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"image/color"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var svgPoint = regexp.MustCompile(`[ML](-?[0-9.e+-]+),(-?[0-9.e+-]+)`)
+
+// svgPolygons returns the points of each subpath of an SVG path
+func svgPolygons(path string) [][][2]float64 {
+	polygons := make([][][2]float64, 0)
+	for _, subpath := range strings.Split(path, "Z") {
+		points := make([][2]float64, 0)
+		for _, m := range svgPoint.FindAllStringSubmatch(subpath, -1) {
+			x, _ := strconv.ParseFloat(m[1], 64)
+			y, _ := strconv.ParseFloat(m[2], 64)
+			points = append(points, [2]float64{x, y})
+		}
+		if len(points) > 0 {
+			polygons = append(polygons, points)
+		}
+	}
+	return polygons
+}
+
+// insidePolygon reports whether a point is inside a polygon, by counting the
+// edges a line from it crosses
+func insidePolygon(x, y float64, points [][2]float64) bool {
+	inside := false
+	for i := range points {
+		a, b := points[i], points[(i+1)%len(points)]
+		if (a[1] > y) != (b[1] > y) && x < a[0]+(y-a[1])*(b[0]-a[0])/(b[1]-a[1]) {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// TestSVGRayMatchesRaster checks that the wedges drawn for a ray in SVG cover
+// the same points of the scene as the ray does when rendered as pixels.
+func TestSVGRayMatchesRaster(t *testing.T) {
+	s := Scene{width: 1920, height: 1080}
+	for _, r := range []Ray{
+		newRay(color.White, 960, 540, 0, 5),
+		newRay(color.White, 100, 900, 30, 40),
+		newRay(color.White, 1800, 50, 200, 60),
+		newRay(color.White, 960, 540, 135, 89),
+		newRay(color.White, 300, 300, 10, 90),
+		newRay(color.White, 960, 540, 0, 120),
+	} {
+		output := svgRay(r, s)
+		if r.size >= 90 {
+			if !strings.Contains(output, "<rect width=\"100%\" height=\"100%\"") {
+				t.Errorf("Ray of size %v doesn't cover the scene: %v", r.size, output)
+			}
+			continue
+		}
+		polygons := svgPolygons(output)
+		for x := 0.0; x <= s.width; x += 20 {
+			for y := 0.0; y <= s.height; y += 20 {
+				// Points right on the edge of a ray, or its middle point, may
+				// fall either way
+				if math.Hypot(x-r.x, y-r.y) < 1 {
+					continue
+				}
+				angle := math.Atan2(y-r.y, x-r.x) * 180 / math.Pi
+				diff := math.Mod(math.Abs(angle-r.angle), 180)
+				if math.Abs(math.Min(diff, 180-diff)-r.size) < 0.5 {
+					continue
+				}
+				inside := false
+				for _, p := range polygons {
+					inside = inside || insidePolygon(x, y, p)
+				}
+				if inside != (r.alpha(x, y) > 0) {
+					t.Errorf("Ray %+v: SVG and raster differ at %v,%v", r, x, y)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strings"
+)
+
+// Layout of the swatch image, in pixels
+const (
+	swatchScale      = 2 // Scale of the built in font
+	swatchMargin     = 32
+	swatchCellWidth  = 136
+	swatchCellGap    = 12
+	swatchBlockSize  = 64
+	swatchTitleBar   = 28
+	swatchTermMargin = 16
+)
+
+var (
+	swatchPage   = color.NRGBA{30, 30, 30, 255}
+	swatchText   = color.NRGBA{220, 220, 220, 255}
+	swatchBorder = color.NRGBA{90, 90, 90, 255}
+	swatchBar    = color.NRGBA{58, 58, 58, 255}
+)
+
+// relativeLuminance returns the luminance of a color as defined by WCAG 2,
+// from 0 for black to 1 for white.
+func relativeLuminance(c color.Color) float64 {
+	cc := nrgba(c)
+	linear := func(v uint8) float64 {
+		f := float64(v) / 255
+		if f <= 0.03928 {
+			return f / 12.92
+		}
+		return math.Pow((f+0.055)/1.055, 2.4)
+	}
+	return 0.2126*linear(cc.R) + 0.7152*linear(cc.G) + 0.0722*linear(cc.B)
+}
+
+// contrastRatio returns the WCAG 2 contrast ratio of two colors, from 1 to 21
+func contrastRatio(a color.Color, b color.Color) float64 {
+	la, lb := relativeLuminance(a), relativeLuminance(b)
+	if la < lb {
+		la, lb = lb, la
+	}
+	return (la + 0.05) / (lb + 0.05)
+}
+
+func fillRect(img *image.NRGBA, r image.Rectangle, c color.Color) {
+	draw.Draw(img, r, image.NewUniform(c), image.Point{}, draw.Src)
+}
+
+// fillCircle draws a filled circle centered on x, y
+func fillCircle(img *image.NRGBA, x int, y int, radius int, c color.Color) {
+	for dy := -radius; dy <= radius; dy++ {
+		for dx := -radius; dx <= radius; dx++ {
+			if dx*dx+dy*dy <= radius*radius {
+				img.Set(x+dx, y+dy, c)
+			}
+		}
+	}
+}
+
+// renderSwatch draws a labeled grid of the palette, with the contrast of each
+// color against the background, above a mock terminal window showing the
+// sample text of the terminal preview.
+func renderSwatch(colors []color.Color) image.Image {
+	line := lineAdvance * swatchScale
+	columns := 8
+	rows := (len(colors) + columns - 1) / columns
+	cellHeight := swatchBlockSize + 8 + 3*line + 16
+
+	width := 2*swatchMargin + columns*swatchCellWidth + (columns-1)*swatchCellGap
+	gridHeight := rows*cellHeight + 2*line
+	termHeight := swatchTitleBar + 2*swatchTermMargin + len(previewSamples)*line
+	height := 2*swatchMargin + gridHeight + termHeight
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	fillRect(img, img.Bounds(), swatchPage)
+
+	for i, c := range colors {
+		x := swatchMargin + (i%columns)*(swatchCellWidth+swatchCellGap)
+		y := swatchMargin + (i/columns)*cellHeight
+		block := image.Rect(x, y, x+swatchCellWidth, y+swatchBlockSize)
+		fillRect(img, block, swatchBorder)
+		fillRect(img, block.Inset(1), c)
+
+		y += swatchBlockSize + 8
+		drawText(img, x, y, fmt.Sprintf("%d %v", i, slotNames[i%8]), swatchText, swatchScale)
+		drawText(img, x, y+line, svgColor(c), swatchText, swatchScale)
+		drawText(img, x, y+2*line, fmt.Sprintf("%.2f:1", contrastRatio(c, colors[backgroundSlot])), swatchText, swatchScale)
+	}
+	y := swatchMargin + rows*cellHeight
+	drawText(img, swatchMargin, y, "Contrast ratios are against the background, color 0", swatchText, swatchScale)
+
+	// Mock terminal window
+	y += 2 * line
+	window := image.Rect(swatchMargin, y, width-swatchMargin, y+termHeight)
+	fillRect(img, window, swatchBorder)
+	fillRect(img, image.Rect(window.Min.X+1, y+1, window.Max.X-1, y+swatchTitleBar), swatchBar)
+	for i, c := range []color.Color{colors[1], colors[3], colors[2]} {
+		fillCircle(img, window.Min.X+16+i*20, y+swatchTitleBar/2, 6, c)
+	}
+	fillRect(img, image.Rect(window.Min.X+1, y+swatchTitleBar, window.Max.X-1, window.Max.Y-1), colors[backgroundSlot])
+
+	y += swatchTitleBar + swatchTermMargin
+	for _, spans := range previewSamples {
+		x := window.Min.X + swatchTermMargin
+		for _, span := range spans {
+			c := colors[foregroundSlot]
+			if span.slot >= 0 {
+				c = colors[span.slot]
+			}
+			text := strings.Replace(span.text, "\t", "    ", -1)
+			drawText(img, x, y, text, c, swatchScale)
+			x += len(text) * glyphAdvance * swatchScale
+		}
+		y += line
+	}
+	return img
+}
+
+// encodePNG returns an image as PNG data
+func encodePNG(img image.Image) string {
+	var buf bytes.Buffer
+	// Encoding an in-memory image to memory can't fail
+	png.Encode(&buf, img)
+	return buf.String()
+}
+
+// printSwatch returns the swatch image as a PNG
+func printSwatch(colors []color.Color) string {
+	return encodePNG(renderSwatch(colors))
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// runOrWatch reads the colors and writes every output. With -watch, it then
+// does it again each time the input file changes, until interrupted.
+func runOrWatch(input_format string, filename string, targets []outputTarget) error {
+	run := func() error {
+		colors, err := readColors(input_format, filename)
+		if err != nil {
+			return err
+		}
+		return writeOutputs(colors, targets)
+	}
+	if !*watch {
+		return run()
+	}
+	if input_format == "live" {
+		return errors.New("Live input can't be watched, as it isn't read from a file.")
+	}
+	return watchInput(filename, run)
+}
+
+// watchInput calls run, and calls it again whenever filename changes.
+// Changes are only acted on once the file has stopped changing for the
+// -watchDelay, so that a burst of saves only regenerates the outputs once.
+// Errors from run, including failed post hooks, are reported, and watching
+// carries on.
+func watchInput(filename string, run func() error) error {
+	regenerate := func() {
+		err := run()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+		fmt.Fprintln(os.Stderr, time.Now().Format("15:04:05"), "Wrote outputs from", filename)
+	}
+
+	changes := make(chan bool, 1)
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- watchFile(filename, changes)
+	}()
+
+	regenerate()
+	fmt.Fprintln(os.Stderr, "Watching", filename, "for changes. Press Ctrl-C to stop.")
+
+	debounce := time.NewTimer(0)
+	<-debounce.C
+	for {
+		select {
+		case <-changes:
+			debounce.Reset(*watchDelay)
+		case <-debounce.C:
+			regenerate()
+		case err := <-watchErr:
+			return err
+		}
+	}
+}
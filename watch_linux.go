@@ -0,0 +1,56 @@
+package main
+
+import (
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// watchFile sends on changes each time the file is written, using inotify.
+// It only returns if watching fails.
+func watchFile(filename string, changes chan<- bool) error {
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	// Watch the directory, since editors often save by replacing the file,
+	// which would end a watch on the file itself
+	_, err = syscall.InotifyAddWatch(fd, filepath.Dir(path), syscall.IN_CLOSE_WRITE|syscall.IN_MOVED_TO)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := syscall.Read(fd, buf)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			name := string(buf[nameStart : nameStart+int(event.Len)])
+			// Names are padded with null bytes
+			for len(name) > 0 && name[len(name)-1] == 0 {
+				name = name[:len(name)-1]
+			}
+			if name == filepath.Base(path) {
+				select {
+				case changes <- true:
+				default:
+					// A change is already waiting to be handled
+				}
+			}
+			offset = nameStart + int(event.Len)
+		}
+	}
+}
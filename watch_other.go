@@ -0,0 +1,37 @@
+//go:build !linux
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// How often to check the input file, where inotify isn't available
+const watchPollInterval = 500 * time.Millisecond
+
+// watchFile sends on changes each time the file's modification time or size
+// changes. It only returns if watching fails.
+func watchFile(filename string, changes chan<- bool) error {
+	var lastMod time.Time
+	var lastSize int64
+	if info, err := os.Stat(filename); err == nil {
+		lastMod, lastSize = info.ModTime(), info.Size()
+	}
+	for {
+		time.Sleep(watchPollInterval)
+		info, err := os.Stat(filename)
+		if err != nil {
+			// The file may be in the middle of being replaced
+			continue
+		}
+		if info.ModTime().Equal(lastMod) && info.Size() == lastSize {
+			continue
+		}
+		lastMod, lastSize = info.ModTime(), info.Size()
+		select {
+		case changes <- true:
+		default:
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Deepest nesting of #include files followed, to stop include loops
+const maxIncludeDepth = 16
+
+// An xresource is one "name: value" line, after preprocessing
+type xresource struct {
+	name  string
+	value string
+}
+
+// xresourcesParser reads Xresources files the way xrdb does, running them
+// through a small C preprocessor first.
+type xresourcesParser struct {
+	defines   map[string]string
+	resources []xresource
+}
+
+var (
+	cComments   = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	identifiers = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*`)
+	definedTest = regexp.MustCompile(`defined\s*\(?\s*([A-Za-z_][A-Za-z0-9_]*)\s*\)?`)
+)
+
+// substitute replaces defined names in text with their values, following
+// macros defined in terms of other macros.
+func (p *xresourcesParser) substitute(text string) string {
+	for i := 0; i < 8; i++ {
+		replaced := identifiers.ReplaceAllStringFunc(text, func(name string) string {
+			if value, ok := p.defines[name]; ok {
+				return value
+			}
+			return name
+		})
+		if replaced == text {
+			break
+		}
+		text = replaced
+	}
+	return text
+}
+
+// condition evaluates the expression of an #if, which may test whether names
+// are defined and compare numbers to zero.
+func (p *xresourcesParser) condition(expr string) (bool, error) {
+	expr = definedTest.ReplaceAllStringFunc(expr, func(test string) string {
+		if _, ok := p.defines[definedTest.FindStringSubmatch(test)[1]]; ok {
+			return "1"
+		}
+		return "0"
+	})
+	expr = strings.TrimSpace(p.substitute(expr))
+	negate := strings.HasPrefix(expr, "!")
+	expr = strings.TrimSpace(strings.TrimPrefix(expr, "!"))
+	n, err := strconv.Atoi(expr)
+	if err != nil {
+		return false, errors.New("Unsupported #if condition: " + expr)
+	}
+	return (n != 0) != negate, nil
+}
+
+// parseFile preprocesses an Xresources file, and any file it includes,
+// collecting its resources in order.
+func (p *xresourcesParser) parseFile(filename string, depth int) error {
+	if depth > maxIncludeDepth {
+		return errors.New("Too many nested #include files at " + filename)
+	}
+	config, err := readFile(filename)
+	if err != nil {
+		return err
+	}
+	config = cComments.ReplaceAllString(config, "")
+	config = strings.Replace(config, "\\\n", "", -1)
+
+	// Whether each enclosing #if is true, whether any of its branches has
+	// been, and whether its #else was reached
+	type conditional struct {
+		active   bool
+		taken    bool
+		elseSeen bool
+	}
+	conditionals := make([]conditional, 0)
+	activeIn := func(conditionals []conditional) bool {
+		for _, c := range conditionals {
+			if !c.active {
+				return false
+			}
+		}
+		return true
+	}
+	active := func() bool {
+		return activeIn(conditionals)
+	}
+
+	for n, l := range strings.Split(config, "\n") {
+		l = strings.TrimSpace(l)
+		where := fmt.Sprintf("%v:%d: ", filename, n+1)
+
+		if strings.HasPrefix(l, "#") {
+			fields := strings.Fields(strings.TrimSpace(l[1:]))
+			if len(fields) == 0 {
+				continue
+			}
+			directive, rest := fields[0], strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(l[1:]), fields[0]))
+			switch directive {
+			case "ifdef", "ifndef":
+				_, defined := p.defines[rest]
+				result := defined == (directive == "ifdef")
+				conditionals = append(conditionals, conditional{active: result, taken: result})
+			case "if":
+				result := false
+				if active() {
+					result, err = p.condition(rest)
+					if err != nil {
+						return errors.New(where + err.Error())
+					}
+				}
+				conditionals = append(conditionals, conditional{active: result, taken: result})
+			case "elif":
+				if len(conditionals) == 0 || conditionals[len(conditionals)-1].elseSeen {
+					return errors.New(where + "#elif without #if")
+				}
+				last := &conditionals[len(conditionals)-1]
+				result := false
+				// Only evaluated when no earlier branch was taken
+				if !last.taken && activeIn(conditionals[:len(conditionals)-1]) {
+					result, err = p.condition(rest)
+					if err != nil {
+						return errors.New(where + err.Error())
+					}
+				}
+				last.active, last.taken = result, last.taken || result
+			case "else":
+				if len(conditionals) == 0 || conditionals[len(conditionals)-1].elseSeen {
+					return errors.New(where + "#else without #if")
+				}
+				last := &conditionals[len(conditionals)-1]
+				last.active, last.taken, last.elseSeen = !last.taken, true, true
+			case "endif":
+				if len(conditionals) == 0 {
+					return errors.New(where + "#endif without #if")
+				}
+				conditionals = conditionals[:len(conditionals)-1]
+			case "define":
+				if !active() {
+					continue
+				}
+				if len(fields) < 2 || strings.Contains(fields[1], "(") {
+					return errors.New(where + "Unsupported #define: " + l)
+				}
+				p.defines[fields[1]] = strings.TrimSpace(strings.TrimPrefix(rest, fields[1]))
+			case "undef":
+				if active() {
+					delete(p.defines, rest)
+				}
+			case "include":
+				if !active() {
+					continue
+				}
+				included := strings.Trim(rest, "\"<>")
+				if !filepath.IsAbs(included) {
+					included = filepath.Join(filepath.Dir(filename), included)
+				}
+				err = p.parseFile(included, depth+1)
+				if err != nil {
+					return err
+				}
+			}
+			// Other directives, such as #pragma, don't affect resources
+			continue
+		}
+
+		if !active() || l == "" || strings.HasPrefix(l, "!") {
+			continue
+		}
+		colon := strings.Index(l, ":")
+		if colon < 0 {
+			continue
+		}
+		p.resources = append(p.resources, xresource{
+			name:  p.substitute(strings.TrimSpace(l[:colon])),
+			value: p.substitute(strings.TrimSpace(l[colon+1:])),
+		})
+	}
+	if len(conditionals) > 0 {
+		return errors.New(filename + ": #if without #endif")
+	}
+	return nil
+}
+
+// xresourceSlot returns the palette slot a resource name sets, or -1. The
+// background and foreground fill their usual slots when no color does.
+func xresourceSlot(name string) int {
+	last := name[strings.LastIndexAny(name, ".*")+1:]
+	switch last {
+	case "background":
+		return backgroundSlot
+	case "foreground":
+		return foregroundSlot
+	}
+	if !strings.HasPrefix(last, "color") {
+		return -1
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(last, "color"))
+	if err != nil || n < 0 || n > 255 {
+		return -1
+	}
+	return n
+}
+
+// Classes of the programs that read each Xresources format
+var (
+	xtermClasses = []string{"XTerm", "UXTerm"}
+	urxvtClasses = []string{"URxvt", "Rxvt"}
+)
+
+// resourcePrecedence ranks how specific a resource is to one of classes, as X
+// does: 2 for one naming the program, Eg. "URxvt.color1", 1 for one that
+// applies to every program, Eg. "*color1", and 0 for another program's.
+func resourcePrecedence(name string, classes []string) int {
+	prefix := strings.Trim(name[:strings.LastIndexAny(name, ".*")+1], ".*")
+	if prefix == "" {
+		return 1
+	}
+	program := prefix[:strings.IndexAny(prefix+".", ".*")]
+	for _, class := range classes {
+		if strings.EqualFold(program, class) {
+			return 2
+		}
+	}
+	return 0
+}
+
+// An alpha percentage before a color, as urxvt allows, Eg. "[80]#000000"
+var alphaPrefix = regexp.MustCompile(`^\[([0-9]{1,3})\]\s*(.*)$`)
+
+// parseXresourcesColor parses a color, with an optional alpha percentage
+func parseXresourcesColor(value string) (color.Color, error) {
+	m := alphaPrefix.FindStringSubmatch(value)
+	if m == nil {
+		return parseColor(value)
+	}
+	c, err := parseColor(m[2])
+	if err != nil {
+		return nil, err
+	}
+	percent, _ := strconv.Atoi(m[1])
+	return withOpacity(c, float64(percent)/100), nil
+}
+
+func inputXterm(filename string) ([]color.Color, error) {
+	return inputXresources(filename, xtermClasses)
+}
+
+func inputURxvt(filename string) ([]color.Color, error) {
+	return inputXresources(filename, urxvtClasses)
+}
+
+// inputXresources reads the colors of an Xresources file by number, for the
+// program of one of classes. When a color is set more than once, a setting
+// for that program ("URxvt.color1") wins over one for every program
+// ("*color1"), which wins over one for another program ("XTerm.color1"),
+// and otherwise the last one wins.
+func inputXresources(filename string, classes []string) ([]color.Color, error) {
+	p := xresourcesParser{defines: make(map[string]string)}
+	err := p.parseFile(filename, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// The value of each slot, and the precedence of the resource it came from
+	type setting struct {
+		value      string
+		precedence int
+	}
+	values := make(map[int]setting)
+	// Colors set by "background" and "foreground", used if no colorN sets them
+	special := make(map[int]setting)
+	set := func(values map[int]setting, slot int, r xresource) {
+		precedence := resourcePrecedence(r.name, classes)
+		if old, ok := values[slot]; ok && old.precedence > precedence {
+			return
+		}
+		values[slot] = setting{r.value, precedence}
+	}
+	highest := -1
+	for _, r := range p.resources {
+		slot := xresourceSlot(r.name)
+		if slot < 0 {
+			continue
+		}
+		if strings.HasSuffix(r.name, "ground") {
+			set(special, slot, r)
+			continue
+		}
+		set(values, slot, r)
+		if slot > highest {
+			highest = slot
+		}
+	}
+	for slot, s := range special {
+		if _, ok := values[slot]; !ok {
+			values[slot] = s
+			if slot > highest {
+				highest = slot
+			}
+		}
+	}
+	if highest < 0 {
+		return nil, errors.New("No colors found in " + filename)
+	}
+
+	colors := make([]color.Color, 0)
+	for i := 0; i <= highest; i++ {
+		s, ok := values[i]
+		if !ok {
+			// The 16 standard colors must all be set, but extra colors
+			// are only read up to the first one that isn't, as a file
+			// may set just a few of the 256 for other programs
+			if i >= 16 {
+				break
+			}
+			return nil, errors.New("color" + strconv.Itoa(i) + " is not set in " + filename)
+		}
+		col, err := parseXresourcesColor(s.value)
+		if err != nil {
+			return nil, err
+		}
+		colors = append(colors, col)
+	}
+
+	// urxvt's background can be transparent even when color0 is set
+	if s, ok := special[backgroundSlot]; ok && alphaPrefix.MatchString(s.value) {
+		background, err := parseXresourcesColor(s.value)
+		if err != nil {
+			return nil, err
+		}
+		colors[backgroundSlot] = withOpacity(colors[backgroundSlot], opacity(background))
+	}
+	return colors, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeXresources writes lines to an Xresources file in a temporary directory
+func writeXresources(t *testing.T, lines ...string) string {
+	filename := filepath.Join(t.TempDir(), "Xresources")
+	err := ioutil.WriteFile(filename, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestXresourcesElif(t *testing.T) {
+	for _, test := range []struct {
+		defines  []string
+		expected string
+	}{
+		{[]string{"#define A"}, "#111111"},
+		{[]string{"#define A", "#define B"}, "#111111"},
+		{[]string{"#define B"}, "#222222"},
+		{nil, "#333333"},
+		{[]string{"#define OUTER 0"}, "#555555"},
+	} {
+		lines := append(test.defines,
+			"*color0: #555555",
+			"#ifndef OUTER",
+			"#if defined(A)",
+			"*color0: #111111",
+			"#elif defined(B)",
+			"*color0: #222222",
+			"#elif 1",
+			"*color0: #333333",
+			"#else",
+			"*color0: #444444",
+			"#endif",
+			"#endif",
+		)
+		colors, err := inputXterm(writeXresources(t, lines...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if svgColor(colors[0]) != test.expected {
+			t.Errorf("With %v, read color0 as %v, expected %v", test.defines, svgColor(colors[0]), test.expected)
+		}
+	}
+
+	_, err := inputXterm(writeXresources(t, "#if 0", "#else", "#elif 1", "#endif", "*color0: #000000"))
+	if err == nil {
+		t.Error("Expected an error for #elif after #else")
+	}
+}
+
+func TestXresourcesPrecedence(t *testing.T) {
+	filename := writeXresources(t,
+		"URxvt.color0: #111111",
+		"*color0: #222222",
+		"XTerm*color0: #333333",
+		"*.color1: #444444",
+		"XTerm.vt100.color1: #555555",
+		"UXTerm*color2: #666666",
+	)
+	for _, test := range []struct {
+		format   string
+		expected []string
+	}{
+		{"xterm", []string{"#333333", "#555555", "#666666"}},
+		{"urxvt", []string{"#111111", "#444444", "#666666"}},
+	} {
+		f, _ := findFormat(test.format)
+		colors, err := f.input(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, expected := range test.expected {
+			if svgColor(colors[i]) != expected {
+				t.Errorf("%v read color%d as %v, expected %v", test.format, i, svgColor(colors[i]), expected)
+			}
+		}
+	}
+}
+
+func TestXresourcesExtraColors(t *testing.T) {
+	standard := make([]string, 16)
+	for i := range standard {
+		standard[i] = fmt.Sprintf("*color%d: #%02x0000", i, i)
+	}
+	for _, test := range []struct {
+		extra    []string
+		expected int
+	}{
+		{nil, 16},
+		{[]string{"*color66: #ffffff"}, 16},
+		{[]string{"*color16: #ffffff", "*color17: #ffffff", "*color66: #ffffff"}, 18},
+	} {
+		colors, err := inputXterm(writeXresources(t, append(append([]string{}, standard...), test.extra...)...))
+		if err != nil {
+			t.Errorf("With %v: %v", test.extra, err)
+		} else if len(colors) != test.expected {
+			t.Errorf("With %v, read %d colors, expected %d", test.extra, len(colors), test.expected)
+		}
+	}
+
+	// A gap in the standard colors is still an error
+	_, err := inputXterm(writeXresources(t, "*color0: #000000", "*color2: #000000"))
+	if err == nil || !strings.Contains(err.Error(), "color1 is not set") {
+		t.Errorf("Expected color1 to be missing, got %v", err)
+	}
+}